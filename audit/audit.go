@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// Entry records the outcome of one operation changing broker state.
+type Entry struct {
+	Time                time.Time                `json:"time"`
+	Operation           osb.Operation            `json:"operation"`
+	InstanceID          string                   `json:"instance_id"`
+	BindingID           string                   `json:"binding_id,omitempty"`
+	OriginatingIdentity *osb.OriginatingIdentity `json:"originating_identity,omitempty"`
+	Status              int                      `json:"status"`
+}
+
+// Logger writes an Entry per provision, update, deprovision, bind and unbind
+// as JSON lines. Reads are not audited.
+type Logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func New(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+func (l *Logger) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		route := osb.Parse(r.Method, r.URL.Path)
+		if !route.Operation.IsMutating() {
+			next(w, r)
+			return
+		}
+
+		rw, ok := w.(negroni.ResponseWriter)
+		if !ok {
+			rw = negroni.NewResponseWriter(w)
+		}
+
+		start := time.Now()
+		next(rw, r)
+
+		entry := Entry{
+			Time:       start,
+			Operation:  route.Operation,
+			InstanceID: route.InstanceID,
+			BindingID:  route.BindingID,
+			Status:     rw.Status(),
+		}
+		if identity, ok := osb.ParseOriginatingIdentity(r); ok {
+			entry.OriginatingIdentity = &identity
+		}
+
+		l.write(entry, r.Header)
+	})
+}
+
+func (l *Logger) write(entry Entry, h http.Header) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Failed to encode audit entry: " + err.Error())
+		return
+	}
+	line = append([]byte(redact.Secrets(string(line), h)), '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.w.Write(line); err != nil {
+		log.Println("Failed to write audit entry: " + err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/audit"
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var (
+		out     *bytes.Buffer
+		logger  *audit.Logger
+		proxied = func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Authorization", "Bearer secret-token")
+			w.WriteHeader(http.StatusAccepted)
+		}
+	)
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+		logger = audit.New(out)
+	})
+
+	var send = func(method, target string) {
+		req := httptest.NewRequest(method, target, nil)
+		// {"user_id":"secret-token"}
+		req.Header.Set(osb.OriginatingIdentityHeader, "cloudfoundry eyJ1c2VyX2lkIjoic2VjcmV0LXRva2VuIn0=")
+		logger.Middleware()(httptest.NewRecorder(), req, proxied)
+	}
+
+	var entries = func() []audit.Entry {
+		var entries []audit.Entry
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry audit.Entry
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	It("writes an entry per mutating operation", func() {
+		send("PUT", "/v2/service_instances/123")
+		send("PATCH", "/v2/service_instances/123")
+		send("PUT", "/v2/service_instances/123/service_bindings/456")
+		send("DELETE", "/v2/service_instances/123/service_bindings/456")
+		send("DELETE", "/v2/service_instances/123")
+
+		logged := entries()
+		Expect(logged).To(HaveLen(5))
+
+		var operations []osb.Operation
+		for _, entry := range logged {
+			operations = append(operations, entry.Operation)
+			Expect(entry.InstanceID).To(Equal("123"))
+			Expect(entry.Status).To(Equal(http.StatusAccepted))
+			Expect(entry.Time).NotTo(BeZero())
+			Expect(entry.OriginatingIdentity.Platform).To(Equal("cloudfoundry"))
+		}
+		Expect(operations).To(Equal([]osb.Operation{osb.Provision, osb.Update, osb.Bind, osb.Unbind, osb.Deprovision}))
+		Expect(logged[2].BindingID).To(Equal("456"))
+	})
+
+	It("writes nothing for reads", func() {
+		send("GET", "/v2/catalog")
+		send("GET", "/v2/service_instances/123")
+		send("GET", "/v2/service_instances/123/last_operation")
+
+		Expect(out.String()).To(BeEmpty())
+	})
+
+	It("redacts the token", func() {
+		send("PUT", "/v2/service_instances/123")
+
+		Expect(out.String()).To(ContainSubstring("[REDACTED]"))
+		Expect(out.String()).NotTo(ContainSubstring("secret-token"))
+	})
+})
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/urfave/negroni"
+)
+
+type adminKey struct{}
+
+// AdminAuth lets requests carrying the admin credentials through, marked so
+// IsAdmin reports them, and hands every other request to fallback, usually
+// BasicAuth with the platform credentials.
+func AdminAuth(username, password string, fallback negroni.HandlerFunc) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if user, pass, ok := r.BasicAuth(); ok && user == username && pass == password {
+			next(w, r.WithContext(context.WithValue(r.Context(), adminKey{}, true)))
+			return
+		}
+		fallback(w, r, next)
+	})
+}
+
+// IsAdmin reports whether r was authenticated with the admin credentials.
+func IsAdmin(r *http.Request) bool {
+	admin, _ := r.Context().Value(adminKey{}).(bool)
+	return admin
+}
+
+// RequireAdmin answers requests not marked by AdminAuth with a 403, for
+// endpoints that only the admin credentials may use.
+func RequireAdmin() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if !IsAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("This endpoint requires admin credentials"))
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/urfave/negroni"
+)
+
+// SourceAllowlist only lets through requests from addresses within allowed,
+// responding 403 to anyone else. The client address is the remote address of
+// the connection, or with trustedHops > 0 the X-Forwarded-For entry appended
+// by the outermost of that many trusted proxies in front of the proxy. Entries
+// further left could have been sent by the client itself and are ignored.
+func SourceAllowlist(allowed []*net.IPNet, trustedHops int) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ip := clientIP(r, trustedHops)
+		if ip == nil || !contains(allowed, ip) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Source address not allowed"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs. Plain IPs are taken as
+// a single address.
+func ParseCIDRs(cidrs string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR: %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// clientIP walks trustedHops entries back from the connection's remote
+// address along X-Forwarded-For. It returns nil when the chain is shorter
+// than the trusted hops, as the request did not come through them.
+func clientIP(r *http.Request, trustedHops int) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	chain := []string{host}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		chain = append(chain, strings.TrimSpace(forwarded[i]))
+	}
+
+	if trustedHops >= len(chain) {
+		return nil
+	}
+	return net.ParseIP(chain[trustedHops])
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
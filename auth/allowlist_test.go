@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SourceAllowlist", func() {
+	var (
+		req    *http.Request
+		called bool
+	)
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequest("GET", "/v2/catalog", nil)
+		Expect(err).ToNot(HaveOccurred())
+		called = false
+	})
+
+	var check = func(cidrs string, trustedHops int) *httptest.ResponseRecorder {
+		allowed, err := auth.ParseCIDRs(cidrs)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer := httptest.NewRecorder()
+		auth.SourceAllowlist(allowed, trustedHops)(writer, req, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+		return writer
+	}
+
+	It("lets allowed remote addresses through", func() {
+		req.RemoteAddr = "10.0.1.5:51234"
+
+		check("10.0.0.0/16, 192.168.1.1", 0)
+
+		Expect(called).To(BeTrue())
+	})
+
+	It("rejects other remote addresses with a 403", func() {
+		req.RemoteAddr = "10.1.0.5:51234"
+
+		writer := check("10.0.0.0/16", 0)
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("ignores X-Forwarded-For without trusted hops", func() {
+		req.RemoteAddr = "10.1.0.5:51234"
+		req.Header.Set("X-Forwarded-For", "10.0.1.5")
+
+		check("10.0.0.0/16", 0)
+
+		Expect(called).To(BeFalse())
+	})
+
+	Context("behind trusted proxies", func() {
+		BeforeEach(func() {
+			req.RemoteAddr = "172.16.0.2:51234"
+		})
+
+		It("uses the address appended by the outermost trusted proxy", func() {
+			req.Header.Add("X-Forwarded-For", "203.0.113.9")
+			req.Header.Add("X-Forwarded-For", "10.0.1.5, 172.16.0.1")
+
+			check("10.0.0.0/16", 2)
+
+			Expect(called).To(BeTrue())
+		})
+
+		It("ignores addresses the client put in X-Forwarded-For itself", func() {
+			req.Header.Set("X-Forwarded-For", "10.0.1.5, 203.0.113.9")
+
+			writer := check("10.0.0.0/16", 1)
+
+			Expect(called).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects requests that did not pass through all trusted proxies", func() {
+			req.Header.Set("X-Forwarded-For", "10.0.1.5")
+
+			check("10.0.0.0/8, 172.16.0.0/12", 3)
+
+			Expect(called).To(BeFalse())
+		})
+	})
+
+	Describe("ParseCIDRs", func() {
+		It("rejects invalid entries", func() {
+			_, err := auth.ParseCIDRs("10.0.0.0/16,example.com")
+			Expect(err).To(MatchError("Invalid CIDR: example.com"))
+		})
+	})
+})
@@ -8,6 +8,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
 )
 
 var _ = Describe("BasicAuth", func() {
@@ -67,3 +68,71 @@ var _ = Describe("BasicAuth", func() {
 		})
 	})
 })
+
+var _ = Describe("AdminAuth", func() {
+	var (
+		handler  negroni.HandlerFunc
+		admin    bool
+		called   bool
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		handler = auth.AdminAuth("admin", "secret", auth.BasicAuth("user", "pass"))
+		called, admin = false, false
+		recorder = httptest.NewRecorder()
+	})
+
+	var send = func(username, password string) {
+		req, _ := http.NewRequest("GET", "/v2/catalog", nil)
+		req.SetBasicAuth(username, password)
+		handler(recorder, req, func(w http.ResponseWriter, r *http.Request) {
+			called, admin = true, auth.IsAdmin(r)
+		})
+	}
+
+	It("marks requests with the admin credentials as admin", func() {
+		send("admin", "secret")
+
+		Expect(called).To(BeTrue())
+		Expect(admin).To(BeTrue())
+	})
+
+	It("lets requests with the platform credentials through as non-admin", func() {
+		send("user", "pass")
+
+		Expect(called).To(BeTrue())
+		Expect(admin).To(BeFalse())
+	})
+
+	It("rejects other credentials", func() {
+		send("admin", "pass")
+
+		Expect(called).To(BeFalse())
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	Describe("RequireAdmin", func() {
+		BeforeEach(func() {
+			adminAuth, requireAdmin := handler, auth.RequireAdmin()
+			handler = func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+				adminAuth(w, r, func(w http.ResponseWriter, r *http.Request) {
+					requireAdmin(w, r, next)
+				})
+			}
+		})
+
+		It("lets requests with the admin credentials through", func() {
+			send("admin", "secret")
+
+			Expect(called).To(BeTrue())
+		})
+
+		It("forbids requests with the platform credentials", func() {
+			send("user", "pass")
+
+			Expect(called).To(BeFalse())
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request method,
+// path, raw query, Date header and ContentSHA256Header, separated by
+// newlines. When the request carries an X-HTTP-Method-Override header, its
+// value is signed too, after another newline, so the method cannot be changed
+// without the secret.
+const SignatureHeader = "X-Proxy-Signature"
+
+// ContentSHA256Header carries the hex encoded SHA-256 of the request body,
+// which is signed in its place.
+const ContentSHA256Header = "X-Content-SHA256"
+
+// maxSignedBodyBytes bounds the request bodies HMACAuth reads to check them
+// against their digest.
+const maxSignedBodyBytes = 1 << 20
+
+// DefaultSignatureWindow is how far the Date of a signed request may be from
+// the current time when HMACAuth is given no window.
+const DefaultSignatureWindow = 5 * time.Minute
+
+// HMACAuth only lets through requests signed with secret, as Sign does,
+// whose Date header is within window of the current time and whose body
+// matches its signed digest. Anyone else gets a 401, or a 413 for bodies
+// larger than 1 MiB. The window limits how long a captured request can be
+// replayed.
+func HMACAuth(secret []byte, window time.Duration) negroni.HandlerFunc {
+	if window <= 0 {
+		window = DefaultSignatureWindow
+	}
+
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+		if err != nil || len(signature) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Missing request signature"))
+			return
+		}
+
+		if !hmac.Equal(signature, signatureOf(r, secret)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Invalid request signature"))
+			return
+		}
+
+		date, err := http.ParseTime(r.Header.Get("Date"))
+		if age := time.Since(date); err != nil || age > window || age < -window {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Request signature expired"))
+			return
+		}
+
+		body, err := readBody(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Failed to read the request body"))
+			return
+		}
+		if len(body) > maxSignedBodyBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Request body too large to verify"))
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get(ContentSHA256Header)), []byte(contentSHA256(body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Request body does not match its signature"))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// Sign sets the Date header of r to now, unless it has one, and the digest
+// of its body, and signs r with secret for HMACAuth. The body is read and
+// replaced with a copy.
+func Sign(r *http.Request, secret []byte, now time.Time) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	r.Header.Set(ContentSHA256Header, contentSHA256(body))
+
+	r.Header.Set(SignatureHeader, hex.EncodeToString(signatureOf(r, secret)))
+	return nil
+}
+
+// readBody reads up to one byte more than maxSignedBodyBytes of the body of
+// r and puts them back in front of the rest, so the body is still read in
+// full further on.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func contentSHA256(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func signatureOf(r *http.Request, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n" + r.Header.Get("Date") + "\n" + r.Header.Get(ContentSHA256Header)))
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		mac.Write([]byte("\n" + override))
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,168 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HMACAuth", func() {
+	var (
+		secret = []byte("gateway-secret")
+		req    *http.Request
+		called bool
+	)
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequest("PUT", "/v2/service_instances/123", nil)
+		Expect(err).ToNot(HaveOccurred())
+		called = false
+	})
+
+	var check = func() *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		auth.HMACAuth(secret, time.Minute)(writer, req, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+		return writer
+	}
+
+	It("lets validly signed requests through", func() {
+		Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+
+		check()
+
+		Expect(called).To(BeTrue())
+	})
+
+	It("rejects requests signed with another secret", func() {
+		Expect(auth.Sign(req, []byte("other-secret"), time.Now())).To(Succeed())
+
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		Expect(writer.Body.String()).To(Equal("Invalid request signature"))
+	})
+
+	It("rejects signed requests that were changed afterwards", func() {
+		Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+		req.Method = "DELETE"
+
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Body.String()).To(Equal("Invalid request signature"))
+	})
+
+	It("rejects signed requests whose query was changed afterwards", func() {
+		req.URL.RawQuery = "accepts_incomplete=true"
+		Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+		req.URL.RawQuery = "accepts_incomplete=false"
+
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Body.String()).To(Equal("Invalid request signature"))
+	})
+
+	Context("when the request has a body", func() {
+		BeforeEach(func() {
+			req, _ = http.NewRequest("PUT", "/v2/service_instances/123", strings.NewReader(`{"plan_id":"small"}`))
+		})
+
+		It("lets it through with the body intact", func() {
+			Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+
+			var body []byte
+			auth.HMACAuth(secret, time.Minute)(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+			})
+
+			Expect(string(body)).To(Equal(`{"plan_id":"small"}`))
+		})
+
+		It("rejects it when the body was changed afterwards", func() {
+			Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"plan_id":"large"}`))
+
+			writer := check()
+
+			Expect(called).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			Expect(writer.Body.String()).To(Equal("Request body does not match its signature"))
+		})
+
+		It("rejects it when the digest was changed to match", func() {
+			Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+			tampered := `{"plan_id":"large"}`
+			req.Body = ioutil.NopCloser(strings.NewReader(tampered))
+			sum := sha256.Sum256([]byte(tampered))
+			req.Header.Set(auth.ContentSHA256Header, hex.EncodeToString(sum[:]))
+
+			writer := check()
+
+			Expect(called).To(BeFalse())
+			Expect(writer.Body.String()).To(Equal("Invalid request signature"))
+		})
+
+		It("rejects bodies too large to verify with a 413", func() {
+			req.Body = ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 1<<20+1)))
+			Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+
+			writer := check()
+
+			Expect(called).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+	})
+
+	It("rejects signed requests whose method override was added afterwards", func() {
+		req.Method = "POST"
+		Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+		req.Header.Set("X-HTTP-Method-Override", "DELETE")
+
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("lets requests signed with their method override through", func() {
+		req.Method = "POST"
+		req.Header.Set("X-HTTP-Method-Override", "DELETE")
+		Expect(auth.Sign(req, secret, time.Now())).To(Succeed())
+
+		check()
+
+		Expect(called).To(BeTrue())
+	})
+
+	It("rejects requests signed outside the freshness window", func() {
+		Expect(auth.Sign(req, secret, time.Now().Add(-2*time.Minute))).To(Succeed())
+
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		Expect(writer.Body.String()).To(Equal("Request signature expired"))
+	})
+
+	It("rejects requests without a signature", func() {
+		writer := check()
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		Expect(writer.Body.String()).To(Equal("Missing request signature"))
+	})
+})
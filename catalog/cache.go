@@ -0,0 +1,264 @@
+package catalog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/clock"
+)
+
+const (
+	Path = "/v2/catalog"
+
+	staleWarning = `110 - "Response is Stale"`
+
+	// maxEntries bounds the catalogs kept for different API versions and
+	// callers.
+	maxEntries = 100
+
+	// maxDecodedBytes bounds the size a compressed catalog may expand to
+	// when decoded for validation.
+	maxDecodedBytes = 16 << 20
+)
+
+// Cache keeps the last successful catalog response. It serves it without
+// contacting the broker while younger than ttl, and as a stale fallback when
+// the broker fails, for as long as it is younger than maxStale. Catalogs are
+// kept per API version and caller, as those may be routed to different
+// brokers or service accounts.
+type Cache struct {
+	ttl      time.Duration
+	maxStale time.Duration
+	clock    clock.Clock
+	validate bool
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+
+	hits, misses, staleServed uint64
+}
+
+// Stats counts how catalog requests were served since the cache was created.
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	StaleServed uint64 `json:"stale_served"`
+}
+
+type entry struct {
+	header  http.Header
+	body    []byte
+	fetched time.Time
+}
+
+type Option func(*Cache)
+
+// WithClock makes the cache age its catalog by c rather than the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(cache *Cache) {
+		cache.clock = c
+	}
+}
+
+// WithValidation only caches catalogs that pass Validate. When the broker
+// serves an invalid catalog the failure is logged and the last good catalog
+// is served in its place, like it is for broker errors. Without a last good
+// catalog the invalid one is forwarded.
+func WithValidation() Option {
+	return func(cache *Cache) {
+		cache.validate = true
+	}
+}
+
+func NewCache(ttl, maxStale time.Duration, opts ...Option) *Cache {
+	cache := &Cache{ttl: ttl, maxStale: maxStale, clock: clock.Real, entries: map[string]*entry{}}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	return cache
+}
+
+func (c *Cache) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if r.Method != http.MethodGet || r.URL.Path != Path {
+			next(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+		cached, age := c.get(key)
+		if cached != nil && age < c.ttl {
+			atomic.AddUint64(&c.hits, 1)
+			cached.write(w, http.StatusOK)
+			return
+		}
+		atomic.AddUint64(&c.misses, 1)
+
+		buf := newResponseBuffer()
+		next(buf, r)
+
+		failure := ""
+		if buf.status >= 500 {
+			failure = fmt.Sprintf("broker responded with %d", buf.status)
+		} else if buf.status == http.StatusOK && c.validate {
+			if err := validateEncoded(buf.header.Get("Content-Encoding"), buf.body.Bytes()); err != nil {
+				log.Printf("Broker served an invalid catalog: %s", err)
+				failure = "broker served an invalid catalog"
+			}
+		}
+
+		switch {
+		case buf.status == http.StatusOK && failure == "":
+			c.set(key, &entry{header: buf.header, body: buf.body.Bytes()})
+		case failure != "" && cached != nil && age <= c.maxStale:
+			log.Printf("Serving stale catalog (age %s), %s", age, failure)
+			atomic.AddUint64(&c.staleServed, 1)
+			w.Header().Set("Warning", staleWarning)
+			cached.write(w, http.StatusOK)
+			return
+		}
+
+		buf.writeTo(w)
+	})
+}
+
+// validateEncoded validates body after decoding it according to its
+// Content-Encoding, as the broker compresses catalogs for callers accepting
+// it.
+func validateEncoded(encoding string, body []byte) error {
+	var decoder io.Reader
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return Validate(body)
+	case "gzip":
+		decoder, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		decoder, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return fmt.Errorf("Catalog has an unsupported Content-Encoding: %s", encoding)
+	}
+	if err != nil {
+		return fmt.Errorf("Catalog could not be decoded: %s", err)
+	}
+
+	decoded, err := ioutil.ReadAll(io.LimitReader(decoder, maxDecodedBytes+1))
+	if err != nil {
+		return fmt.Errorf("Catalog could not be decoded: %s", err)
+	}
+	if len(decoded) > maxDecodedBytes {
+		return fmt.Errorf("Catalog decodes to more than %d bytes", maxDecodedBytes)
+	}
+	return Validate(decoded)
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		StaleServed: atomic.LoadUint64(&c.staleServed),
+	}
+}
+
+// cacheKey tells apart the catalogs of different API versions and callers,
+// and of different encodings, as the broker may compress the catalog for
+// callers accepting it.
+func cacheKey(r *http.Request) string {
+	username, _, _ := r.BasicAuth()
+	return strings.Join([]string{
+		r.Header.Get("X-Broker-API-Version"),
+		username,
+		r.Header.Get("X-Broker-API-Originating-Identity"),
+		r.Header.Get("Accept-Encoding"),
+	}, "\n")
+}
+
+func (c *Cache) get(key string) (*entry, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, 0
+	}
+	return e, c.clock.Now().Sub(e.fetched)
+}
+
+// set stores e under key, making room by dropping the oldest catalog when
+// full.
+func (c *Cache) set(key string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxEntries {
+		var oldest string
+		for k, cached := range c.entries {
+			if oldest == "" || cached.fetched.Before(c.entries[oldest].fetched) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	e.fetched = c.clock.Now()
+	c.entries[key] = e
+}
+
+func (e *entry) write(w http.ResponseWriter, status int) {
+	for name, values := range e.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	w.Write(e.body)
+}
+
+// responseBuffer holds a response back so it can be inspected before it is
+// sent to the client.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
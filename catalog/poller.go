@@ -0,0 +1,114 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sink receives the broker catalog, e.g. to keep an external service catalog
+// in sync. A failed push is retried on the next poll.
+type Sink func(catalog []byte) error
+
+// Poller fetches the catalog in the background and pushes it to a Sink
+// whenever it changes.
+type Poller struct {
+	handler    http.Handler
+	apiVersion string
+	sink       Sink
+
+	pushed      bool
+	fingerprint [sha256.Size]byte
+}
+
+// NewPoller fetches the catalog from handler, which should add the broker
+// token just like for requests from the platform, asking for apiVersion of
+// the OSB API.
+func NewPoller(handler http.Handler, apiVersion string, sink Sink) *Poller {
+	return &Poller{handler: handler, apiVersion: apiVersion, sink: sink}
+}
+
+// Poll pushes the catalog right away, then checks for changes every interval
+// until stop is closed.
+func (p *Poller) Poll(interval time.Duration, stop <-chan struct{}) {
+	p.poll()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+func (p *Poller) poll() {
+	body, err := p.fetch()
+	if err != nil {
+		log.Println("Failed to poll the broker catalog: " + err.Error())
+		return
+	}
+
+	// Fingerprint the catalog with its keys sorted, so a broker that orders
+	// them differently each time does not count as a change.
+	var catalog interface{}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		log.Println("Failed to poll the broker catalog: the body is not JSON")
+		return
+	}
+	normalized, err := json.Marshal(catalog)
+	if err != nil {
+		log.Println("Failed to poll the broker catalog: " + err.Error())
+		return
+	}
+
+	fingerprint := sha256.Sum256(normalized)
+	if p.pushed && fingerprint == p.fingerprint {
+		return
+	}
+
+	if err := p.sink(body); err != nil {
+		log.Println("Failed to push the broker catalog: " + err.Error())
+		return
+	}
+	p.pushed, p.fingerprint = true, fingerprint
+}
+
+func (p *Poller) fetch() ([]byte, error) {
+	req, err := http.NewRequest("GET", "/v2/catalog", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Broker-API-Version", p.apiVersion)
+
+	res := newResponseBuffer()
+	p.handler.ServeHTTP(res, req)
+	if res.status != http.StatusOK && res.status != 0 {
+		return nil, fmt.Errorf("broker responded with %d", res.status)
+	}
+	return res.body.Bytes(), nil
+}
+
+// WebhookSink POSTs the catalog as JSON to url with client.
+func WebhookSink(client *http.Client, url string) Sink {
+	return func(catalog []byte) error {
+		res, err := client.Post(url, "application/json", bytes.NewReader(catalog))
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("%s responded with %d", url, res.StatusCode)
+		}
+		return nil
+	}
+}
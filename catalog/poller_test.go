@@ -0,0 +1,164 @@
+package catalog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/catalog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Poller", func() {
+	var (
+		mu           sync.Mutex
+		brokerStatus int
+		brokerBody   string
+		polls        int
+		apiVersions  []string
+
+		pushes  chan string
+		sinkErr error
+		stop    chan struct{}
+	)
+
+	var setCatalog = func(status int, body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		brokerStatus, brokerBody = status, body
+	}
+
+	var pollCount = func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return polls
+	}
+
+	BeforeEach(func() {
+		log.SetOutput(ioutil.Discard)
+
+		// The poller of the previous spec may still be finishing a poll.
+		mu.Lock()
+		polls, apiVersions, sinkErr = 0, nil, nil
+		pushes = make(chan string, 10)
+		mu.Unlock()
+
+		setCatalog(http.StatusOK, `{"services":[{"id":"s1","name":"sql"}]}`)
+		stop = make(chan struct{})
+	})
+
+	JustBeforeEach(func() {
+		broker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			polls++
+			apiVersions = append(apiVersions, r.Header.Get("X-Broker-API-Version"))
+			w.WriteHeader(brokerStatus)
+			w.Write([]byte(brokerBody))
+		})
+		sink := func(body []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if sinkErr != nil {
+				return sinkErr
+			}
+			pushes <- string(body)
+			return nil
+		}
+
+		go catalog.NewPoller(broker, "2.14", sink).Poll(10*time.Millisecond, stop)
+	})
+
+	AfterEach(func() {
+		close(stop)
+		log.SetOutput(os.Stderr)
+	})
+
+	It("pushes the catalog on startup", func() {
+		Eventually(pushes).Should(Receive(Equal(`{"services":[{"id":"s1","name":"sql"}]}`)))
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(apiVersions[0]).To(Equal("2.14"))
+	})
+
+	It("does not push an unchanged catalog again", func() {
+		Eventually(pushes).Should(Receive())
+		Eventually(pollCount).Should(BeNumerically(">=", 3))
+
+		setCatalog(http.StatusOK, `{"services":[{"name":"sql","id":"s1"}]}`)
+		Consistently(pushes, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("pushes the catalog when it changes", func() {
+		Eventually(pushes).Should(Receive())
+
+		setCatalog(http.StatusOK, `{"services":[{"id":"s1","name":"sql"},{"id":"s2","name":"redis"}]}`)
+		Eventually(pushes).Should(Receive(Equal(`{"services":[{"id":"s1","name":"sql"},{"id":"s2","name":"redis"}]}`)))
+		Consistently(pushes, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Context("when the broker fails", func() {
+		BeforeEach(func() {
+			setCatalog(http.StatusInternalServerError, `{"description":"oops"}`)
+		})
+
+		It("pushes nothing until it serves the catalog", func() {
+			Consistently(pushes, 50*time.Millisecond).ShouldNot(Receive())
+
+			setCatalog(http.StatusOK, `{"services":[]}`)
+			Eventually(pushes).Should(Receive(Equal(`{"services":[]}`)))
+		})
+	})
+
+	Context("when the sink fails", func() {
+		BeforeEach(func() {
+			sinkErr = errors.New("unavailable")
+		})
+
+		It("pushes the catalog again on the next poll", func() {
+			Eventually(pollCount).Should(BeNumerically(">=", 2))
+
+			mu.Lock()
+			sinkErr = nil
+			mu.Unlock()
+			Eventually(pushes).Should(Receive(Equal(`{"services":[{"id":"s1","name":"sql"}]}`)))
+		})
+	})
+})
+
+var _ = Describe("WebhookSink", func() {
+	var server *ghttp.Server
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts the catalog as JSON", func() {
+		server.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/catalogs"),
+			ghttp.VerifyContentType("application/json"),
+			ghttp.VerifyBody([]byte(`{"services":[]}`)),
+		))
+
+		Expect(catalog.WebhookSink(http.DefaultClient, server.URL()+"/catalogs")([]byte(`{"services":[]}`))).To(Succeed())
+	})
+
+	It("fails when the webhook does not accept it", func() {
+		server.AppendHandlers(ghttp.RespondWith(http.StatusServiceUnavailable, nil))
+
+		err := catalog.WebhookSink(http.DefaultClient, server.URL()+"/catalogs")([]byte(`{"services":[]}`))
+		Expect(err).To(MatchError(ContainSubstring("responded with 503")))
+	})
+})
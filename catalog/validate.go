@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Validate checks that body is an OSB catalog: a services array whose
+// services and plans all have an id and a name.
+func Validate(body []byte) error {
+	var catalog struct {
+		Services []struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			Plans []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"plans"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return fmt.Errorf("Catalog is not valid JSON: %s", err)
+	}
+	if catalog.Services == nil {
+		return errors.New("Catalog has no services array")
+	}
+
+	for i, service := range catalog.Services {
+		if service.ID == "" || service.Name == "" {
+			return fmt.Errorf("Catalog service %d is missing an id or name", i)
+		}
+		if len(service.Plans) == 0 {
+			return fmt.Errorf("Catalog service %s has no plans", service.ID)
+		}
+		for j, plan := range service.Plans {
+			if plan.ID == "" || plan.Name == "" {
+				return fmt.Errorf("Catalog plan %d of service %s is missing an id or name", j, service.ID)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package catalog_test
+
+import (
+	"code.cloudfoundry.org/gcp-broker-proxy/catalog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	It("accepts a catalog whose services and plans have ids and names", func() {
+		Expect(catalog.Validate([]byte(`{"services":[{"id":"s1","name":"db","plans":[{"id":"p1","name":"small"}]}]}`))).To(Succeed())
+		Expect(catalog.Validate([]byte(`{"services":[]}`))).To(Succeed())
+	})
+
+	DescribeTable("rejects invalid catalogs",
+		func(body, message string) {
+			Expect(catalog.Validate([]byte(body))).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("not JSON", `nope`, "not valid JSON"),
+		Entry("no services", `{}`, "no services array"),
+		Entry("service without a name", `{"services":[{"id":"s1","plans":[{"id":"p1","name":"small"}]}]}`, "service 0 is missing an id or name"),
+		Entry("service without plans", `{"services":[{"id":"s1","name":"db"}]}`, "service s1 has no plans"),
+		Entry("plan without an id", `{"services":[{"id":"s1","name":"db","plans":[{"name":"small"}]}]}`, "plan 0 of service s1 is missing an id or name"),
+	)
+})
@@ -0,0 +1,18 @@
+package clock
+
+import "time"
+
+// Clock tells the time. Code that expires or ages things takes one, so tests
+// can move time forward instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/httpclient"
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+)
+
+// Duration is a time.Duration written as a string in the config file, e.g.
+// "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("Duration must be a string such as \"30s\": %s", data)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Timeouts struct {
+	Dial           Duration `json:"dial"`
+	TLSHandshake   Duration `json:"tls_handshake"`
+	ResponseHeader Duration `json:"response_header"`
+	ExpectContinue Duration `json:"expect_continue"`
+}
+
+// Config is the content of the config file. Only BrokerURL is structural,
+// everything else can be changed by reloading the file.
+type Config struct {
+	BrokerURL              string   `json:"broker_url"`
+	APIVersion             string   `json:"api_version"`
+	Timeouts               Timeouts `json:"timeouts"`
+	EnforceJSONContentType bool     `json:"enforce_json_content_type"`
+	RetryAsyncRequired     bool     `json:"retry_async_required"`
+	SlowRequestThreshold   Duration `json:"slow_request_threshold"`
+}
+
+func Load(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a JSON config. Unknown settings are rejected so
+// typos do not go unnoticed.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("Invalid config: %s", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c Config) Validate() error {
+	if c.BrokerURL != "" {
+		if _, err := url.ParseRequestURI(c.BrokerURL); err != nil {
+			return fmt.Errorf("Invalid config: broker_url must be a valid URL: %s", c.BrokerURL)
+		}
+	}
+
+	if c.APIVersion != "" && !apiVersionPattern.MatchString(c.APIVersion) {
+		return fmt.Errorf("Invalid config: api_version must be a version such as 2.14: %s", c.APIVersion)
+	}
+
+	for _, setting := range settings {
+		if d, ok := setting.value(c).(Duration); ok && d < 0 {
+			return fmt.Errorf("Invalid config: %s must not be negative", setting.name)
+		}
+	}
+
+	return nil
+}
+
+func (c Config) HTTPClientOptions() []httpclient.Option {
+	var opts []httpclient.Option
+
+	if c.Timeouts.Dial > 0 {
+		opts = append(opts, httpclient.WithDialTimeout(time.Duration(c.Timeouts.Dial)))
+	}
+	if c.Timeouts.TLSHandshake > 0 {
+		opts = append(opts, httpclient.WithTLSHandshakeTimeout(time.Duration(c.Timeouts.TLSHandshake)))
+	}
+	if c.Timeouts.ResponseHeader > 0 {
+		opts = append(opts, httpclient.WithResponseHeaderTimeout(time.Duration(c.Timeouts.ResponseHeader)))
+	}
+	if c.Timeouts.ExpectContinue > 0 {
+		opts = append(opts, httpclient.WithExpectContinueTimeout(time.Duration(c.Timeouts.ExpectContinue)))
+	}
+
+	return opts
+}
+
+func (c Config) ProxyOptions() []proxy.Option {
+	var opts []proxy.Option
+
+	if c.APIVersion != "" {
+		opts = append(opts, proxy.WithDefaultAPIVersion(c.APIVersion))
+	}
+	if c.EnforceJSONContentType {
+		opts = append(opts, proxy.WithJSONContentType())
+	}
+	if c.RetryAsyncRequired {
+		opts = append(opts, proxy.WithAsyncRequiredRetry())
+	}
+	if c.SlowRequestThreshold > 0 {
+		opts = append(opts, proxy.WithSlowRequestLog(time.Duration(c.SlowRequestThreshold)))
+	}
+
+	return opts
+}
+
+var errStructuralChange = errors.New("broker_url cannot be changed without a restart")
+
+var apiVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+var settings = []struct {
+	name  string
+	value func(Config) interface{}
+}{
+	{"broker_url", func(c Config) interface{} { return c.BrokerURL }},
+	{"api_version", func(c Config) interface{} { return c.APIVersion }},
+	{"timeouts.dial", func(c Config) interface{} { return c.Timeouts.Dial }},
+	{"timeouts.tls_handshake", func(c Config) interface{} { return c.Timeouts.TLSHandshake }},
+	{"timeouts.response_header", func(c Config) interface{} { return c.Timeouts.ResponseHeader }},
+	{"timeouts.expect_continue", func(c Config) interface{} { return c.Timeouts.ExpectContinue }},
+	{"enforce_json_content_type", func(c Config) interface{} { return c.EnforceJSONContentType }},
+	{"retry_async_required", func(c Config) interface{} { return c.RetryAsyncRequired }},
+	{"slow_request_threshold", func(c Config) interface{} { return c.SlowRequestThreshold }},
+}
+
+// Changes lists the names of the settings that differ between old and new.
+func Changes(old, new Config) []string {
+	var changed []string
+	for _, setting := range settings {
+		if setting.value(old) != setting.value(new) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,150 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Config", func() {
+	Describe("Parse", func() {
+		It("parses the settings", func() {
+			cfg, err := config.Parse([]byte(`{
+				"broker_url": "https://broker.example.com",
+				"api_version": "2.16",
+				"timeouts": {"dial": "5s", "response_header": "1m"},
+				"enforce_json_content_type": true,
+				"slow_request_threshold": "2s"
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.BrokerURL).To(Equal("https://broker.example.com"))
+			Expect(cfg.APIVersion).To(Equal("2.16"))
+			Expect(cfg.Timeouts.Dial).To(Equal(config.Duration(5 * time.Second)))
+			Expect(cfg.Timeouts.ResponseHeader).To(Equal(config.Duration(time.Minute)))
+			Expect(cfg.Timeouts.TLSHandshake).To(BeZero())
+			Expect(cfg.EnforceJSONContentType).To(BeTrue())
+			Expect(cfg.RetryAsyncRequired).To(BeFalse())
+			Expect(cfg.SlowRequestThreshold).To(Equal(config.Duration(2 * time.Second)))
+
+			Expect(cfg.HTTPClientOptions()).To(HaveLen(2))
+			Expect(cfg.ProxyOptions()).To(HaveLen(3))
+		})
+
+		It("rejects an invalid API version", func() {
+			_, err := config.Parse([]byte(`{"api_version": "latest"}`))
+			Expect(err).To(MatchError("Invalid config: api_version must be a version such as 2.14: latest"))
+		})
+
+		It("rejects an invalid broker URL", func() {
+			_, err := config.Parse([]byte(`{"broker_url": "not a url"}`))
+			Expect(err).To(MatchError("Invalid config: broker_url must be a valid URL: not a url"))
+		})
+
+		It("rejects invalid durations", func() {
+			_, err := config.Parse([]byte(`{"timeouts": {"dial": "soon"}}`))
+			Expect(err).To(MatchError(ContainSubstring("Invalid config")))
+
+			_, err = config.Parse([]byte(`{"timeouts": {"dial": 5}}`))
+			Expect(err).To(MatchError(ContainSubstring("Invalid config")))
+		})
+
+		It("rejects negative durations", func() {
+			_, err := config.Parse([]byte(`{"timeouts": {"tls_handshake": "-1s"}}`))
+			Expect(err).To(MatchError("Invalid config: timeouts.tls_handshake must not be negative"))
+		})
+
+		It("rejects unknown settings", func() {
+			_, err := config.Parse([]byte(`{"enforce_json": true}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "enforce_json"`)))
+		})
+	})
+
+	Describe("Watcher", func() {
+		var (
+			dir       string
+			path      string
+			reloaded  []config.Config
+			watcher   *config.Watcher
+			logBuffer *gbytes.Buffer
+		)
+
+		var writeConfig = func(content string) {
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "config")
+			Expect(err).NotTo(HaveOccurred())
+			path = filepath.Join(dir, "config.json")
+			writeConfig(`{"broker_url": "https://broker.example.com", "timeouts": {"dial": "5s"}}`)
+
+			reloaded = nil
+			watcher, err = config.NewWatcher(path, func(cfg config.Config) {
+				reloaded = append(reloaded, cfg)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			logBuffer = gbytes.NewBuffer()
+			log.SetOutput(logBuffer)
+		})
+
+		AfterEach(func() {
+			log.SetOutput(os.Stderr)
+			os.RemoveAll(dir)
+		})
+
+		It("applies new timeouts on reload and logs what changed", func() {
+			writeConfig(`{"broker_url": "https://broker.example.com", "timeouts": {"dial": "10s", "response_header": "30s"}}`)
+
+			Expect(watcher.Reload()).To(Succeed())
+
+			Expect(reloaded).To(HaveLen(1))
+			Expect(reloaded[0].Timeouts.Dial).To(Equal(config.Duration(10 * time.Second)))
+			Expect(reloaded[0].Timeouts.ResponseHeader).To(Equal(config.Duration(30 * time.Second)))
+			Expect(watcher.Config()).To(Equal(reloaded[0]))
+			Expect(logBuffer).To(gbytes.Say("changed: timeouts.dial, timeouts.response_header"))
+		})
+
+		It("does nothing when no setting changed", func() {
+			Expect(watcher.Reload()).To(Succeed())
+			Expect(reloaded).To(BeEmpty())
+		})
+
+		It("keeps the current config when the file is invalid", func() {
+			writeConfig(`{"timeouts": {"dial": "-5s"}}`)
+
+			Expect(watcher.Reload()).To(HaveOccurred())
+			Expect(reloaded).To(BeEmpty())
+			Expect(watcher.Config().Timeouts.Dial).To(Equal(config.Duration(5 * time.Second)))
+		})
+
+		It("refuses to change the broker URL", func() {
+			writeConfig(`{"broker_url": "https://other.example.com", "timeouts": {"dial": "10s"}}`)
+
+			Expect(watcher.Reload()).To(MatchError("broker_url cannot be changed without a restart"))
+			Expect(reloaded).To(BeEmpty())
+		})
+
+		It("reloads when the file changes", func() {
+			stop := make(chan struct{})
+			defer close(stop)
+			go watcher.Poll(10*time.Millisecond, stop)
+
+			writeConfig(`{"broker_url": "https://broker.example.com", "timeouts": {"dial": "10s"}}`)
+			later := time.Now().Add(time.Second)
+			Expect(os.Chtimes(path, later, later)).To(Succeed())
+
+			Eventually(func() config.Duration { return watcher.Config().Timeouts.Dial }).Should(Equal(config.Duration(10 * time.Second)))
+		})
+	})
+})
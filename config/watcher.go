@@ -0,0 +1,96 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watcher keeps the config loaded from a file and calls onReload with the new
+// config whenever a reload changes any setting.
+type Watcher struct {
+	path     string
+	onReload func(Config)
+
+	mu      sync.Mutex
+	current Config
+	modTime time.Time
+}
+
+func NewWatcher(path string, onReload func(Config)) (*Watcher, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{path: path, onReload: onReload, current: cfg, modTime: modTime(path)}, nil
+}
+
+func (w *Watcher) Config() Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload reads the file again. An invalid file leaves the current config in
+// place, and so does a changed broker_url, which needs a restart.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.modTime = modTime(w.path)
+
+	cfg, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+
+	if cfg.BrokerURL != w.current.BrokerURL {
+		return errStructuralChange
+	}
+
+	changed := Changes(w.current, cfg)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	log.Printf("Reloaded %s, changed: %s\n", w.path, strings.Join(changed, ", "))
+	w.current = cfg
+	w.onReload(cfg)
+	return nil
+}
+
+// Poll reloads the file whenever its modification time changes, until stop is
+// closed.
+func (w *Watcher) Poll(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			unchanged := modTime(w.path).Equal(w.modTime)
+			w.mu.Unlock()
+
+			if unchanged {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				log.Printf("Failed to reload %s: %s\n", w.path, err)
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
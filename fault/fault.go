@@ -0,0 +1,73 @@
+package fault
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/config"
+)
+
+// Config sets how often each fault is injected, as probabilities between 0
+// and 1 drawn independently per request. The zero Config injects nothing.
+type Config struct {
+	LatencyProbability float64         `json:"latency_probability"`
+	Latency            config.Duration `json:"latency"`
+	ErrorProbability   float64         `json:"error_probability"`
+	ErrorStatus        int             `json:"error_status"`
+	DropProbability    float64         `json:"drop_probability"`
+}
+
+// Injector makes the broker look like it misbehaves, for testing how the
+// platform copes. It is meant for chaos testing only, never for production.
+type Injector struct {
+	cfg Config
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func New(cfg Config) *Injector {
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = http.StatusServiceUnavailable
+	}
+	return &Injector{cfg: cfg, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (in *Injector) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if in.roll(in.cfg.LatencyProbability) {
+			select {
+			case <-time.After(time.Duration(in.cfg.Latency)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if in.roll(in.cfg.DropProbability) {
+			// Makes the server close the connection without a response.
+			panic(http.ErrAbortHandler)
+		}
+
+		if in.roll(in.cfg.ErrorProbability) {
+			w.WriteHeader(in.cfg.ErrorStatus)
+			w.Write([]byte("Injected fault"))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (in *Injector) roll(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.rand.Float64() < probability
+}
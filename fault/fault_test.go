@@ -0,0 +1,100 @@
+package fault_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/config"
+	"code.cloudfoundry.org/gcp-broker-proxy/fault"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Injector", func() {
+	const requests = 2000
+
+	var (
+		forwarded int
+		proxied   = func(w http.ResponseWriter, r *http.Request) {
+			forwarded++
+			w.WriteHeader(http.StatusOK)
+		}
+	)
+
+	BeforeEach(func() {
+		forwarded = 0
+	})
+
+	// send returns the status of the response, or 0 when the request was dropped.
+	var send = func(injector *fault.Injector) (status int) {
+		defer func() {
+			if r := recover(); r != nil {
+				Expect(r).To(Equal(http.ErrAbortHandler))
+				status = 0
+			}
+		}()
+
+		w := httptest.NewRecorder()
+		injector.Middleware()(w, httptest.NewRequest("GET", "/v2/catalog", nil), proxied)
+		return w.Code
+	}
+
+	It("injects nothing by default", func() {
+		injector := fault.New(fault.Config{})
+
+		for i := 0; i < requests; i++ {
+			Expect(send(injector)).To(Equal(http.StatusOK))
+		}
+		Expect(forwarded).To(Equal(requests))
+	})
+
+	It("responds with the error status at the configured rate", func() {
+		injector := fault.New(fault.Config{ErrorProbability: 0.3, ErrorStatus: http.StatusInternalServerError})
+
+		errors := 0
+		for i := 0; i < requests; i++ {
+			switch send(injector) {
+			case http.StatusInternalServerError:
+				errors++
+			case http.StatusOK:
+			default:
+				Fail("unexpected status")
+			}
+		}
+
+		Expect(float64(errors) / requests).To(BeNumerically("~", 0.3, 0.05))
+		Expect(forwarded).To(Equal(requests - errors))
+	})
+
+	It("drops requests at the configured rate", func() {
+		injector := fault.New(fault.Config{DropProbability: 0.2})
+
+		dropped := 0
+		for i := 0; i < requests; i++ {
+			if send(injector) == 0 {
+				dropped++
+			}
+		}
+
+		Expect(float64(dropped) / requests).To(BeNumerically("~", 0.2, 0.05))
+		Expect(forwarded).To(Equal(requests - dropped))
+	})
+
+	It("delays requests at the configured rate", func() {
+		injector := fault.New(fault.Config{LatencyProbability: 0.5, Latency: config.Duration(5 * time.Millisecond)})
+
+		delayed := 0
+		for i := 0; i < 200; i++ {
+			start := time.Now()
+			Expect(send(injector)).To(Equal(http.StatusOK))
+			if time.Since(start) >= 5*time.Millisecond {
+				delayed++
+			}
+		}
+
+		Expect(float64(delayed) / 200).To(BeNumerically("~", 0.5, 0.15))
+		Expect(forwarded).To(Equal(200))
+	})
+})
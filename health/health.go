@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Path is where the health of the proxy is served when it is enabled.
+const Path = "/_proxy/health"
+
+const (
+	OK       = "ok"
+	Degraded = "degraded"
+)
+
+// Check probes one component, such as the token source or the broker.
+type Check func(ctx context.Context) error
+
+// Handler reports the status of each component, e.g.
+// {"token":"ok","broker":"degraded"}, or of a single one with
+// ?component=token. It responds with a 503 unless every reported component is
+// ok, so each can be alerted on separately.
+type Handler struct {
+	checks   map[string]Check
+	timeout  time.Duration
+	cacheFor time.Duration
+
+	mu      sync.Mutex
+	results map[string]result
+}
+
+type result struct {
+	status  string
+	checked time.Time
+}
+
+type Option func(*Handler)
+
+// WithCache reuses the result of each check for ttl, so frequent polling
+// does not hit the components every time.
+func WithCache(ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.cacheFor = ttl
+	}
+}
+
+func New(checks map[string]Check, timeout time.Duration, opts ...Option) *Handler {
+	h := &Handler{checks: checks, timeout: timeout, results: map[string]result{}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	checks := h.checks
+	if component := r.URL.Query().Get("component"); component != "" {
+		check, ok := h.checks[component]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Unknown component: " + component))
+			return
+		}
+		checks = map[string]Check{component: check}
+	}
+
+	status := h.run(r.Context(), checks)
+
+	w.Header().Set("Content-Type", "application/json")
+	for _, s := range status {
+		if s != OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// run probes the components concurrently, so a slow one does not hold up the
+// others.
+func (h *Handler) run(ctx context.Context, checks map[string]Check) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		status = make(map[string]string, len(checks))
+	)
+	for name, check := range checks {
+		if cached, ok := h.cached(name); ok {
+			status[name] = cached
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			result := OK
+			if err := check(ctx); err != nil {
+				log.Printf("Health check %s failed: %s\n", name, err)
+				result = Degraded
+			}
+
+			mu.Lock()
+			status[name] = result
+			mu.Unlock()
+			h.store(name, result)
+		}(name, check)
+	}
+	wg.Wait()
+
+	return status
+}
+
+func (h *Handler) cached(name string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.results[name]
+	if !ok || time.Since(r.checked) >= h.cacheFor {
+		return "", false
+	}
+	return r.status, true
+}
+
+func (h *Handler) store(name, status string) {
+	if h.cacheFor <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results[name] = result{status: status, checked: time.Now()}
+}
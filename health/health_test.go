@@ -0,0 +1,113 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/health"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		tokenErr, brokerErr error
+		brokerChecks        int
+		handler             *health.Handler
+	)
+
+	BeforeEach(func() {
+		tokenErr, brokerErr = nil, nil
+		brokerChecks = 0
+		handler = health.New(map[string]health.Check{
+			"token": func(ctx context.Context) error { return tokenErr },
+			"broker": func(ctx context.Context) error {
+				brokerChecks++
+				return brokerErr
+			},
+		}, time.Second)
+		log.SetOutput(GinkgoWriter)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	var get = func(target string) (int, map[string]string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+
+		var status map[string]string
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status
+	}
+
+	It("reports every component", func() {
+		code, status := get(health.Path)
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(map[string]string{"token": "ok", "broker": "ok"}))
+	})
+
+	It("reports a failing component as degraded with a 503", func() {
+		brokerErr = errors.New("broker down")
+
+		code, status := get(health.Path)
+
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status).To(Equal(map[string]string{"token": "ok", "broker": "degraded"}))
+	})
+
+	It("reports a single component on request", func() {
+		brokerErr = errors.New("broker down")
+
+		code, status := get(health.Path + "?component=token")
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(map[string]string{"token": "ok"}))
+		Expect(brokerChecks).To(BeZero())
+	})
+
+	It("runs the checks on every request by default", func() {
+		get(health.Path)
+		get(health.Path)
+
+		Expect(brokerChecks).To(Equal(2))
+	})
+
+	Context("with a cache", func() {
+		BeforeEach(func() {
+			handler = health.New(map[string]health.Check{
+				"broker": func(ctx context.Context) error {
+					brokerChecks++
+					return brokerErr
+				},
+			}, time.Second, health.WithCache(time.Hour))
+		})
+
+		It("reuses check results while they are fresh", func() {
+			brokerErr = errors.New("broker down")
+			get(health.Path)
+			brokerErr = nil
+
+			code, status := get(health.Path + "?component=broker")
+
+			Expect(brokerChecks).To(Equal(1))
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(status).To(Equal(map[string]string{"broker": "degraded"}))
+		})
+	})
+
+	It("responds with a 404 for unknown components", func() {
+		code, _ := get(health.Path + "?component=database")
+
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+})
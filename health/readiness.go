@@ -0,0 +1,33 @@
+package health
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// ReadyPath is where readiness is served.
+const ReadyPath = "/_proxy/readyz"
+
+// Readiness tells starting apart from ready. It responds with a 503 until
+// MarkReady is called, typically once the startup checks passed, and with a
+// 200 from then on.
+type Readiness struct {
+	ready int32
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+func (r *Readiness) MarkReady() {
+	atomic.StoreInt32(&r.ready, 1)
+}
+
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&r.ready) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("starting"))
+		return
+	}
+	w.Write([]byte("ready"))
+}
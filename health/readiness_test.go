@@ -0,0 +1,36 @@
+package health_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/health"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Readiness", func() {
+	var get = func(readiness *health.Readiness) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		readiness.ServeHTTP(w, httptest.NewRequest("GET", health.ReadyPath, nil))
+		return w
+	}
+
+	It("responds with a 503 until marked ready", func() {
+		w := get(health.NewReadiness())
+
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Body.String()).To(Equal("starting"))
+	})
+
+	It("responds with a 200 once marked ready", func() {
+		readiness := health.NewReadiness()
+		readiness.MarkReady()
+
+		w := get(readiness)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("ready"))
+	})
+})
@@ -0,0 +1,213 @@
+package httpcache
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/clock"
+)
+
+// DefaultVary are the request headers that tell cached responses apart on
+// top of the path, query and caller. The originating identity keeps callers
+// on behalf of different users, or tenants, apart.
+var DefaultVary = []string{"Accept", "Accept-Encoding", "X-Broker-API-Version", "X-Broker-API-Originating-Identity"}
+
+// DefaultMaxEntries bounds the responses a cache keeps unless WithMaxEntries
+// says otherwise.
+const DefaultMaxEntries = 1000
+
+// Cache keeps successful responses to GET requests whose path matches one of
+// its patterns for ttl. Responses are keyed by path, query, the basic auth
+// username and the headers to vary on, so only endpoints known to be free of
+// side effects and of per-request state should be allowed. When full, the
+// response closest to expiring makes room for the new one.
+type Cache struct {
+	ttl        time.Duration
+	patterns   []string
+	vary       []string
+	maxEntries int
+	clock      clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	hits, misses uint64
+}
+
+// Stats counts how allowed requests were served since the cache was created.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type entry struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+type Option func(*Cache)
+
+// WithVary keys responses by headers instead of DefaultVary.
+func WithVary(headers ...string) Option {
+	return func(c *Cache) {
+		c.vary = headers
+	}
+}
+
+// WithMaxEntries keeps at most max responses instead of DefaultMaxEntries.
+func WithMaxEntries(max int) Option {
+	return func(c *Cache) {
+		c.maxEntries = max
+	}
+}
+
+// WithClock makes the cache expire responses by c rather than the wall clock.
+func WithClock(clk clock.Clock) Option {
+	return func(c *Cache) {
+		c.clock = clk
+	}
+}
+
+// New caches GET responses for paths matching one of patterns, as understood
+// by path.Match, e.g. /v2/extensions/*/usage.
+func New(ttl time.Duration, patterns []string, opts ...Option) *Cache {
+	c := &Cache{ttl: ttl, patterns: patterns, vary: DefaultVary, maxEntries: DefaultMaxEntries, clock: clock.Real, entries: map[string]*entry{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Cache) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if r.Method != http.MethodGet || !c.allowed(r.URL.Path) {
+			next(w, r)
+			return
+		}
+
+		key := c.key(r)
+		if cached := c.get(key); cached != nil {
+			atomic.AddUint64(&c.hits, 1)
+			for name, values := range cached.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write(cached.body)
+			return
+		}
+		atomic.AddUint64(&c.misses, 1)
+
+		buf := &responseBuffer{header: http.Header{}}
+		next(buf, r)
+
+		if buf.status == http.StatusOK || buf.status == 0 {
+			c.set(key, &entry{header: buf.header, body: buf.body.Bytes()})
+		}
+		buf.writeTo(w)
+	})
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: atomic.LoadUint64(&c.hits), Misses: atomic.LoadUint64(&c.misses)}
+}
+
+func (c *Cache) allowed(requestPath string) bool {
+	for _, pattern := range c.patterns {
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cache) key(r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(r.URL.Path + "?" + r.URL.Query().Encode())
+	username, _, _ := r.BasicAuth()
+	key.WriteString("\n" + username)
+
+	vary := append([]string(nil), c.vary...)
+	sort.Strings(vary)
+	for _, name := range vary {
+		key.WriteString("\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String()
+}
+
+func (c *Cache) get(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.clock.Now().Before(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// set stores e under key, dropping expired entries so keys no longer asked
+// for do not pile up, and the entry closest to expiring when still full.
+func (c *Cache) set(key string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	var oldest string
+	for k, cached := range c.entries {
+		if !now.Before(cached.expires) {
+			delete(c.entries, k)
+		} else if oldest == "" || cached.expires.Before(c.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries && oldest != "" {
+		delete(c.entries, oldest)
+	}
+
+	e.expires = now.Add(c.ttl)
+	c.entries[key] = e
+}
+
+// responseBuffer holds a response back so it can be cached before it is sent
+// to the client.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
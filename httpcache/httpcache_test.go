@@ -0,0 +1,138 @@
+package httpcache_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/httpcache"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		cache        *httpcache.Cache
+		brokerCalls  int
+		brokerStatus int
+		brokerBody   string
+		clock        *fakeClock
+	)
+
+	BeforeEach(func() {
+		brokerCalls = 0
+		brokerStatus = http.StatusOK
+		brokerBody = `{"usage":1}`
+		clock = &fakeClock{now: time.Now()}
+		cache = httpcache.New(time.Minute, []string{"/v2/extensions/*/usage"}, httpcache.WithClock(clock))
+	})
+
+	var get = func(target string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		cache.Middleware()(w, req, func(w http.ResponseWriter, r *http.Request) {
+			brokerCalls++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(brokerStatus)
+			w.Write([]byte(brokerBody))
+		})
+		return w
+	}
+
+	It("serves allowed GETs from the cache until they expire", func() {
+		get("/v2/extensions/123/usage?period=day")
+		brokerBody = `{"usage":2}`
+
+		w := get("/v2/extensions/123/usage?period=day")
+		Expect(brokerCalls).To(Equal(1))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal(`{"usage":1}`))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(cache.Stats()).To(Equal(httpcache.Stats{Hits: 1, Misses: 1}))
+
+		clock.now = clock.now.Add(time.Minute)
+		Expect(get("/v2/extensions/123/usage?period=day").Body.String()).To(Equal(`{"usage":2}`))
+		Expect(brokerCalls).To(Equal(2))
+	})
+
+	It("keys responses by path, query and the vary headers", func() {
+		get("/v2/extensions/123/usage?period=day&unit=gb")
+		get("/v2/extensions/123/usage?unit=gb&period=day")
+		Expect(brokerCalls).To(Equal(1))
+
+		get("/v2/extensions/123/usage?period=week")
+		get("/v2/extensions/456/usage?period=day&unit=gb")
+		get("/v2/extensions/123/usage?period=day&unit=gb", "X-Broker-API-Version", "2.16")
+		Expect(brokerCalls).To(Equal(4))
+	})
+
+	It("keys responses by caller", func() {
+		get("/v2/extensions/123/usage", "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("tenant-a:pass")))
+		get("/v2/extensions/123/usage", "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("tenant-b:pass")))
+		get("/v2/extensions/123/usage", "X-Broker-API-Originating-Identity", "cloudfoundry eyJ1c2VyX2lkIjoiYSJ9")
+		get("/v2/extensions/123/usage", "X-Broker-API-Originating-Identity", "cloudfoundry eyJ1c2VyX2lkIjoiYiJ9")
+		Expect(brokerCalls).To(Equal(4))
+
+		get("/v2/extensions/123/usage", "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("tenant-a:pass")))
+		Expect(brokerCalls).To(Equal(4))
+	})
+
+	It("makes room by dropping the response closest to expiring", func() {
+		cache = httpcache.New(time.Minute, []string{"/v2/extensions/*/usage"}, httpcache.WithClock(clock), httpcache.WithMaxEntries(2))
+
+		get("/v2/extensions/1/usage")
+		clock.now = clock.now.Add(time.Second)
+		get("/v2/extensions/2/usage")
+		get("/v2/extensions/3/usage")
+		Expect(brokerCalls).To(Equal(3))
+
+		get("/v2/extensions/2/usage")
+		get("/v2/extensions/3/usage")
+		Expect(brokerCalls).To(Equal(3))
+		get("/v2/extensions/1/usage")
+		Expect(brokerCalls).To(Equal(4))
+	})
+
+	It("does not cache GETs outside the allowed paths", func() {
+		get("/v2/service_instances/123")
+		get("/v2/service_instances/123")
+
+		Expect(brokerCalls).To(Equal(2))
+		Expect(cache.Stats()).To(Equal(httpcache.Stats{}))
+	})
+
+	It("does not cache failed responses", func() {
+		brokerStatus = http.StatusServiceUnavailable
+		get("/v2/extensions/123/usage")
+		brokerStatus = http.StatusOK
+
+		Expect(get("/v2/extensions/123/usage").Code).To(Equal(http.StatusOK))
+		Expect(brokerCalls).To(Equal(2))
+	})
+
+	It("does not cache other methods", func() {
+		handler := negroni.New(cache.Middleware(), negroni.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			brokerCalls++
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v2/extensions/123/usage", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v2/extensions/123/usage", nil))
+
+		Expect(brokerCalls).To(Equal(2))
+	})
+})
+
+// fakeClock tells whatever time the test sets.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
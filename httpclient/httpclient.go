@@ -0,0 +1,171 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Option func(*config)
+
+type config struct {
+	dialer        *net.Dialer
+	dialerOpts    []func(*net.Dialer)
+	transportOpts []func(*http.Transport)
+}
+
+// New returns a client for talking to the broker, with transport settings
+// tuned by the given options.
+func New(opts ...Option) *http.Client {
+	cfg := &config{
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	for _, opt := range cfg.dialerOpts {
+		opt(cfg.dialer)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = cfg.dialer.DialContext
+	for _, opt := range cfg.transportOpts {
+		opt(transport)
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// WithoutRedirects returns a copy of client, sharing its connections, that
+// returns redirects to the caller instead of following them.
+func WithoutRedirects(client *http.Client) *http.Client {
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &c
+}
+
+// WithDialer makes the client open connections with d. The other options
+// still apply to it.
+func WithDialer(d *net.Dialer) Option {
+	return func(c *config) {
+		c.dialer = d
+	}
+}
+
+// WithKeepAlive enables TCP keepalive probes on broker connections, so
+// connections silently dropped by intermediaries are detected. A probe is sent
+// after idle, then every interval, and the connection is closed after count
+// unanswered probes.
+func WithKeepAlive(idle, interval time.Duration, count int) Option {
+	return func(c *config) {
+		c.dialerOpts = append(c.dialerOpts, func(d *net.Dialer) {
+			d.KeepAlive = idle
+			d.KeepAliveConfig = net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     idle,
+				Interval: interval,
+				Count:    count,
+			}
+		})
+	}
+}
+
+// WithHTTP2HealthCheck pings HTTP/2 connections that received no frame for
+// readIdleTimeout, and closes them if the ping is not answered within
+// pingTimeout.
+func WithHTTP2HealthCheck(readIdleTimeout, pingTimeout time.Duration) Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			if t.HTTP2 == nil {
+				t.HTTP2 = &http.HTTP2Config{}
+			}
+			t.HTTP2.SendPingTimeout = readIdleTimeout
+			t.HTTP2.PingTimeout = pingTimeout
+		})
+	}
+}
+
+// WithLocalAddr makes broker connections originate from addr, for deployments
+// where firewall rules expect a specific source address.
+func WithLocalAddr(addr *net.TCPAddr) Option {
+	return func(c *config) {
+		c.dialerOpts = append(c.dialerOpts, func(d *net.Dialer) {
+			d.LocalAddr = addr
+		})
+	}
+}
+
+// ParseLocalAddr parses a local bind address given either as an IP or as an
+// IP and port.
+func ParseLocalAddr(addr string) (*net.TCPAddr, error) {
+	host, port := addr, "0"
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid local address: %s", addr)
+	}
+
+	return net.ResolveTCPAddr("tcp", net.JoinHostPort(ip.String(), port))
+}
+
+// WithDialTimeout bounds how long establishing a connection to the broker may
+// take, DNS lookup included.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.dialerOpts = append(c.dialerOpts, func(d *net.Dialer) {
+			d.Timeout = timeout
+		})
+	}
+}
+
+// WithTLSHandshakeTimeout bounds how long the TLS handshake with the broker
+// may take.
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			t.TLSHandshakeTimeout = timeout
+		})
+	}
+}
+
+// WithResponseHeaderTimeout bounds how long to wait for the broker's response
+// headers once the request has been written.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			t.ResponseHeaderTimeout = timeout
+		})
+	}
+}
+
+// WithExpectContinueTimeout bounds how long to wait for the broker's 100
+// Continue on requests sent with Expect: 100-continue before sending the body
+// anyway.
+func WithExpectContinueTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			t.ExpectContinueTimeout = timeout
+		})
+	}
+}
+
+// WithDisableKeepAlives opens a new connection to the broker for every
+// request, for brokers behind load balancers that pin a backend per
+// connection and expect each request to be balanced on its own.
+func WithDisableKeepAlives() Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			t.DisableKeepAlives = true
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package httpclient_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/httpclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("New", func() {
+	var transportOf = func(client *http.Client) *http.Transport {
+		transport, ok := client.Transport.(*http.Transport)
+		Expect(ok).To(BeTrue())
+		return transport
+	}
+
+	It("returns a client that can reach a server", func() {
+		server := ghttp.NewServer()
+		defer server.Close()
+		server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "{}"))
+
+		res, err := httpclient.New().Get(server.URL())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	Describe("WithoutRedirects", func() {
+		It("returns redirects instead of following them", func() {
+			server := ghttp.NewServer()
+			defer server.Close()
+			server.AppendHandlers(ghttp.RespondWith(http.StatusFound, "", http.Header{"Location": []string{"/elsewhere"}}))
+
+			client := httpclient.New()
+			res, err := httpclient.WithoutRedirects(client).Get(server.URL())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusFound))
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+			Expect(client.CheckRedirect).To(BeNil())
+		})
+
+		It("shares the connections of the client", func() {
+			client := httpclient.New()
+			Expect(httpclient.WithoutRedirects(client).Transport).To(BeIdenticalTo(client.Transport))
+		})
+	})
+
+	It("does not share the default transport", func() {
+		Expect(transportOf(httpclient.New())).NotTo(BeIdenticalTo(http.DefaultTransport))
+	})
+
+	Describe("WithKeepAlive", func() {
+		It("configures keepalive probing on the dialer", func() {
+			dialer := &net.Dialer{}
+			httpclient.New(
+				httpclient.WithKeepAlive(10*time.Second, 5*time.Second, 3),
+				httpclient.WithDialer(dialer),
+			)
+
+			Expect(dialer.KeepAliveConfig).To(Equal(net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     10 * time.Second,
+				Interval: 5 * time.Second,
+				Count:    3,
+			}))
+		})
+	})
+
+	Describe("WithHTTP2HealthCheck", func() {
+		It("configures ping based health checks on the transport", func() {
+			transport := transportOf(httpclient.New(httpclient.WithHTTP2HealthCheck(30*time.Second, 10*time.Second)))
+
+			Expect(transport.HTTP2).NotTo(BeNil())
+			Expect(transport.HTTP2.SendPingTimeout).To(Equal(30 * time.Second))
+			Expect(transport.HTTP2.PingTimeout).To(Equal(10 * time.Second))
+		})
+
+		It("is disabled by default", func() {
+			transport := transportOf(httpclient.New())
+			if transport.HTTP2 != nil {
+				Expect(transport.HTTP2.SendPingTimeout).To(BeZero())
+			}
+		})
+	})
+
+	Describe("WithLocalAddr", func() {
+		It("binds the dialer to the local address", func() {
+			localAddr, err := httpclient.ParseLocalAddr("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			dialer := &net.Dialer{}
+			httpclient.New(httpclient.WithDialer(dialer), httpclient.WithLocalAddr(localAddr))
+
+			Expect(dialer.LocalAddr).To(Equal(localAddr))
+		})
+
+		It("originates broker connections from the local address", func() {
+			server := ghttp.NewServer()
+			defer server.Close()
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "{}"))
+
+			localAddr, err := httpclient.ParseLocalAddr("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = httpclient.New(httpclient.WithLocalAddr(localAddr)).Get(server.URL())
+			Expect(err).NotTo(HaveOccurred())
+
+			host, _, err := net.SplitHostPort(server.ReceivedRequests()[0].RemoteAddr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(host).To(Equal("127.0.0.1"))
+		})
+	})
+
+	Describe("WithDisableKeepAlives", func() {
+		var remoteAddrs = func(client *http.Client) []string {
+			server := ghttp.NewServer()
+			defer server.Close()
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "{}"), ghttp.RespondWith(http.StatusOK, "{}"))
+
+			for i := 0; i < 2; i++ {
+				res, err := client.Get(server.URL())
+				Expect(err).NotTo(HaveOccurred())
+				ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+
+			var addrs []string
+			for _, req := range server.ReceivedRequests() {
+				addrs = append(addrs, req.RemoteAddr)
+			}
+			return addrs
+		}
+
+		It("disables keep-alives on the transport", func() {
+			Expect(transportOf(httpclient.New(httpclient.WithDisableKeepAlives())).DisableKeepAlives).To(BeTrue())
+			Expect(transportOf(httpclient.New()).DisableKeepAlives).To(BeFalse())
+		})
+
+		It("uses a new connection for every request", func() {
+			addrs := remoteAddrs(httpclient.New(httpclient.WithDisableKeepAlives()))
+			Expect(addrs[0]).NotTo(Equal(addrs[1]))
+		})
+
+		It("reuses connections by default", func() {
+			addrs := remoteAddrs(httpclient.New())
+			Expect(addrs[0]).To(Equal(addrs[1]))
+		})
+	})
+
+	Describe("WithSPKIPins", func() {
+		var (
+			server  *ghttp.Server
+			rootCAs *x509.CertPool
+			pin     []byte
+		)
+
+		BeforeEach(func() {
+			server = ghttp.NewTLSServer()
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "{}"))
+
+			cert := server.HTTPTestServer.Certificate()
+			rootCAs = x509.NewCertPool()
+			rootCAs.AddCert(cert)
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			pin = digest[:]
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		var get = func(pins ...[]byte) error {
+			client := httpclient.New(httpclient.WithSPKIPins(pins...))
+			transportOf(client).TLSClientConfig.RootCAs = rootCAs
+			_, err := client.Get(server.URL())
+			return err
+		}
+
+		It("completes the handshake when the certificate matches a pin", func() {
+			other := sha256.Sum256([]byte("other key"))
+			Expect(get(other[:], pin)).To(Succeed())
+		})
+
+		It("fails the handshake when no certificate matches a pin", func() {
+			other := sha256.Sum256([]byte("other key"))
+			Expect(get(other[:])).To(MatchError(ContainSubstring(httpclient.ErrSPKIPinMismatch.Error())))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Describe("ParseSPKIPin", func() {
+		It("decodes base64 pins with or without the sha256/ prefix", func() {
+			digest := sha256.Sum256([]byte("key"))
+			encoded := base64.StdEncoding.EncodeToString(digest[:])
+
+			pin, err := httpclient.ParseSPKIPin(encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pin).To(Equal(digest[:]))
+
+			pin, err = httpclient.ParseSPKIPin("sha256/" + encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pin).To(Equal(digest[:]))
+		})
+
+		It("rejects pins that are not SHA-256 digests", func() {
+			_, err := httpclient.ParseSPKIPin("dG9vIHNob3J0")
+			Expect(err).To(MatchError("Invalid SPKI pin: dG9vIHNob3J0"))
+		})
+	})
+
+	Describe("ParseLocalAddr", func() {
+		It("accepts an IP with a port", func() {
+			addr, err := httpclient.ParseLocalAddr("10.0.0.1:5000")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.IP.String()).To(Equal("10.0.0.1"))
+			Expect(addr.Port).To(Equal(5000))
+		})
+
+		It("accepts an IPv6 address", func() {
+			addr, err := httpclient.ParseLocalAddr("::1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.IP.String()).To(Equal("::1"))
+			Expect(addr.Port).To(Equal(0))
+		})
+
+		It("rejects host names and garbage", func() {
+			_, err := httpclient.ParseLocalAddr("example.com")
+			Expect(err).To(MatchError("Invalid local address: example.com"))
+
+			_, err = httpclient.ParseLocalAddr("not an address")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("connection timeouts", func() {
+		It("carries the configured timeouts", func() {
+			dialer := &net.Dialer{}
+			transport := transportOf(httpclient.New(
+				httpclient.WithDialer(dialer),
+				httpclient.WithDialTimeout(2*time.Second),
+				httpclient.WithTLSHandshakeTimeout(3*time.Second),
+				httpclient.WithResponseHeaderTimeout(4*time.Second),
+				httpclient.WithExpectContinueTimeout(5*time.Second),
+			))
+
+			Expect(dialer.Timeout).To(Equal(2 * time.Second))
+			Expect(transport.TLSHandshakeTimeout).To(Equal(3 * time.Second))
+			Expect(transport.ResponseHeaderTimeout).To(Equal(4 * time.Second))
+			Expect(transport.ExpectContinueTimeout).To(Equal(5 * time.Second))
+		})
+
+		Context("when the broker stalls the TLS handshake", func() {
+			var listener net.Listener
+
+			BeforeEach(func() {
+				var err error
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+
+				go func() {
+					for {
+						conn, err := listener.Accept()
+						if err != nil {
+							return
+						}
+						defer conn.Close()
+					}
+				}()
+			})
+
+			AfterEach(func() {
+				listener.Close()
+			})
+
+			It("fails once the handshake timeout is reached", func() {
+				client := httpclient.New(httpclient.WithTLSHandshakeTimeout(50 * time.Millisecond))
+
+				start := time.Now()
+				_, err := client.Get("https://" + listener.Addr().String())
+
+				Expect(err).To(MatchError(ContainSubstring("TLS handshake timeout")))
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			})
+		})
+
+		Context("when the broker is slow to send response headers", func() {
+			It("fails once the response header timeout is reached", func() {
+				server := ghttp.NewServer()
+				defer server.Close()
+				server.AppendHandlers(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(200 * time.Millisecond)
+				})
+
+				client := httpclient.New(httpclient.WithResponseHeaderTimeout(50 * time.Millisecond))
+				_, err := client.Get(server.URL())
+
+				Expect(err).To(MatchError(ContainSubstring("timeout awaiting response headers")))
+			})
+		})
+	})
+})
@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrSPKIPinMismatch fails the TLS handshake with a broker whose certificates
+// match none of the configured pins.
+var ErrSPKIPinMismatch = errors.New("Broker certificate does not match any SPKI pin")
+
+// WithSPKIPins only completes TLS handshakes with brokers whose verified chain
+// contains a certificate whose public key has one of the given SHA-256 SPKI
+// digests. The usual certificate verification still applies.
+func WithSPKIPins(pins ...[]byte) Option {
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			t.TLSClientConfig.VerifyPeerCertificate = verifySPKIPins(pins)
+		})
+	}
+}
+
+// ParseSPKIPin decodes a base64 SHA-256 SPKI pin, optionally prefixed with
+// sha256/ as in HPKP headers and `openssl` recipes.
+func ParseSPKIPin(pin string) ([]byte, error) {
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("Invalid SPKI pin: %s", pin)
+	}
+	return digest, nil
+}
+
+func verifySPKIPins(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+		}
+
+		for _, cert := range certs {
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(digest[:], pin) {
+					return nil
+				}
+			}
+		}
+		return ErrSPKIPinMismatch
+	}
+}
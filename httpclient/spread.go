@@ -0,0 +1,124 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultConnectionStagger is how long a connection attempt gets before the
+// next address is tried alongside it, as recommended for Happy Eyeballs.
+const DefaultConnectionStagger = 250 * time.Millisecond
+
+// Resolver looks up the addresses of the broker. *net.Resolver is one.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WithConnectionSpreading resolves the broker host with resolver,
+// net.DefaultResolver when nil, and spreads new connections over all its
+// addresses in turn. When an attempt fails, or has not connected within
+// stagger, the next address is tried alongside it and the first connection
+// made is used, so an unhealthy address only costs stagger.
+func WithConnectionSpreading(stagger time.Duration, resolver Resolver) Option {
+	if stagger <= 0 {
+		stagger = DefaultConnectionStagger
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return func(c *config) {
+		c.transportOpts = append(c.transportOpts, func(t *http.Transport) {
+			d := &spreadingDialer{dial: t.DialContext, resolver: resolver, stagger: stagger}
+			t.DialContext = d.DialContext
+		})
+	}
+}
+
+type spreadingDialer struct {
+	dial     func(ctx context.Context, network, address string) (net.Conn, error)
+	resolver Resolver
+	stagger  time.Duration
+	next     uint32
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (d *spreadingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, address)
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No addresses found for %s", host)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := int(atomic.AddUint32(&d.next, 1) - 1)
+	results := make(chan dialResult, len(addrs))
+	launched, failed := 0, 0
+	launch := func() {
+		ip := addrs[(start+launched)%len(addrs)]
+		launched++
+		go func() {
+			conn, err := d.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(d.stagger)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				go closeLosers(results, launched-failed-1)
+				return res.conn, nil
+			}
+
+			failed++
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if failed == len(addrs) {
+				return nil, firstErr
+			}
+			if launched < len(addrs) {
+				launch()
+				timer.Reset(d.stagger)
+			}
+		case <-timer.C:
+			if launched < len(addrs) {
+				launch()
+				timer.Reset(d.stagger)
+			}
+		}
+	}
+}
+
+// closeLosers closes the connections of attempts still running when another
+// one won.
+func closeLosers(results chan dialResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package httpclient_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/httpclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeResolver resolves every host to the same addresses.
+type fakeResolver struct {
+	addrs []string
+}
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	for _, addr := range r.addrs {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(addr)})
+	}
+	return addrs, nil
+}
+
+var _ = Describe("WithConnectionSpreading", func() {
+	var (
+		mu        sync.Mutex
+		servedBy  []string
+		listeners []net.Listener
+		port      int
+	)
+
+	// serve answers on ip at port, remembering which address served each
+	// request.
+	var serve = func(ip string) error {
+		listener, err := net.Listen("tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+		port = listener.Addr().(*net.TCPAddr).Port
+
+		go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			servedBy = append(servedBy, ip)
+		}))
+		return nil
+	}
+
+	BeforeEach(func() {
+		servedBy = nil
+		listeners = nil
+		port = 0
+	})
+
+	AfterEach(func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	})
+
+	var get = func(client *http.Client) {
+		res, err := client.Get(fmt.Sprintf("http://broker.internal:%d/v2/catalog", port))
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+	}
+
+	It("spreads new connections over the resolved addresses", func() {
+		Expect(serve("127.0.0.1")).To(Succeed())
+		if err := serve("127.0.0.2"); err != nil {
+			Skip("127.0.0.2 is not a loopback address here: " + err.Error())
+		}
+
+		client := httpclient.New(
+			httpclient.WithDisableKeepAlives(),
+			httpclient.WithConnectionSpreading(time.Second, fakeResolver{addrs: []string{"127.0.0.1", "127.0.0.2"}}),
+		)
+		for i := 0; i < 4; i++ {
+			get(client)
+		}
+
+		Expect(servedBy).To(Equal([]string{"127.0.0.1", "127.0.0.2", "127.0.0.1", "127.0.0.2"}))
+	})
+
+	It("moves on to the next address when one refuses connections", func() {
+		Expect(serve("127.0.0.1")).To(Succeed())
+
+		client := httpclient.New(httpclient.WithConnectionSpreading(time.Minute, fakeResolver{addrs: []string{"127.0.0.3", "127.0.0.1"}}))
+
+		start := time.Now()
+		get(client)
+
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(servedBy).To(Equal([]string{"127.0.0.1"}))
+	})
+
+	It("tries the next address alongside one that does not answer", func() {
+		Expect(serve("127.0.0.1")).To(Succeed())
+
+		// 192.0.2.0/24 is reserved for documentation and never routed.
+		client := httpclient.New(httpclient.WithConnectionSpreading(50*time.Millisecond, fakeResolver{addrs: []string{"192.0.2.1", "127.0.0.1"}}))
+
+		start := time.Now()
+		get(client)
+
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(servedBy).To(Equal([]string{"127.0.0.1"}))
+	})
+})
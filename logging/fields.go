@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"strings"
+
+	"github.com/urfave/negroni"
+)
+
+// WithFields appends the fields given by fields, e.g. "instance_id=123
+// plan_id=small", to every line logged through logger. They are looked up as
+// each line is logged.
+func WithFields(logger negroni.ALogger, fields func() string) negroni.ALogger {
+	return fieldsLogger{logger: logger, fields: fields}
+}
+
+type fieldsLogger struct {
+	logger negroni.ALogger
+	fields func() string
+}
+
+func (l fieldsLogger) Println(v ...interface{}) {
+	if fields := l.fields(); fields != "" {
+		v = append(v, fields)
+	}
+	l.logger.Println(v...)
+}
+
+// Printf keeps the line break ending format, as in the lines of
+// negroni.Logger, at the end of the line.
+func (l fieldsLogger) Printf(format string, v ...interface{}) {
+	fields := l.fields()
+	if fields == "" {
+		l.logger.Printf(format, v...)
+		return
+	}
+	trimmed := strings.TrimRight(format, " \t\n")
+	l.logger.Printf(trimmed+" | "+strings.Replace(fields, "%", "%%", -1)+format[len(trimmed):], v...)
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var names = map[string]Level{"debug": Debug, "info": Info, "warn": Warn, "error": Error}
+
+// prefixes mark lines logged at levels other than Info, which stays
+// unmarked as it always was.
+var prefixes = map[Level]string{Debug: "DEBUG ", Warn: "WARN ", Error: "ERROR "}
+
+var level int32 = int32(Info)
+
+// SetLevel sets the lowest level that is logged. Info is logged by default.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+func ParseLevel(s string) (Level, error) {
+	l, ok := names[strings.ToLower(s)]
+	if !ok {
+		return Info, fmt.Errorf("Unknown log level: %s", s)
+	}
+	return l, nil
+}
+
+func Enabled(l Level) bool {
+	return int32(l) >= atomic.LoadInt32(&level)
+}
+
+// Debugf logs through the standard logger when debug logging is enabled.
+func Debugf(format string, args ...interface{}) {
+	if Enabled(Debug) {
+		log.Printf(prefixes[Debug]+format, args...)
+	}
+}
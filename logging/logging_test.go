@@ -0,0 +1,134 @@
+package logging_test
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Logging", func() {
+	var logBuffer *gbytes.Buffer
+
+	BeforeEach(func() {
+		logBuffer = gbytes.NewBuffer()
+		log.SetOutput(logBuffer)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+		logging.SetLevel(logging.Info)
+	})
+
+	It("does not log debug messages by default", func() {
+		logging.Debugf("hidden %d", 1)
+		Expect(logBuffer.Contents()).To(BeEmpty())
+	})
+
+	It("logs debug messages at the debug level", func() {
+		logging.SetLevel(logging.Debug)
+		logging.Debugf("shown %d", 1)
+		Expect(logBuffer).To(gbytes.Say("DEBUG shown 1"))
+	})
+
+	It("parses level names", func() {
+		Expect(logging.ParseLevel("DEBUG")).To(Equal(logging.Debug))
+		Expect(logging.ParseLevel("info")).To(Equal(logging.Info))
+		Expect(logging.ParseLevel("warn")).To(Equal(logging.Warn))
+		Expect(logging.ParseLevel("Error")).To(Equal(logging.Error))
+
+		_, err := logging.ParseLevel("loud")
+		Expect(err).To(MatchError("Unknown log level: loud"))
+	})
+})
+
+var _ = Describe("StatusLogger", func() {
+	var (
+		logBuffer *gbytes.Buffer
+		logger    negroni.ALogger
+		status    int
+		levels    = logging.StatusLevels{2: logging.Debug, 4: logging.Info, 5: logging.Error}
+	)
+
+	BeforeEach(func() {
+		logBuffer = gbytes.NewBuffer()
+		logger = logging.StatusLogger(log.New(logBuffer, "", 0), levels, func() int { return status })
+	})
+
+	AfterEach(func() {
+		logging.SetLevel(logging.Info)
+	})
+
+	It("drops successful requests configured below the current level", func() {
+		status = http.StatusOK
+		logger.Printf("200 | GET /v2/catalog\n")
+
+		Expect(logBuffer.Contents()).To(BeEmpty())
+	})
+
+	It("logs successful requests at debug when enabled", func() {
+		logging.SetLevel(logging.Debug)
+		status = http.StatusOK
+		logger.Printf("200 | GET /v2/catalog\n")
+
+		Expect(logBuffer).To(gbytes.Say("DEBUG 200 | GET /v2/catalog"))
+	})
+
+	It("logs server errors at the configured high level", func() {
+		logging.SetLevel(logging.Warn)
+		status = http.StatusInternalServerError
+		logger.Printf("500 | PUT /v2/service_instances/1\n")
+
+		Expect(logBuffer).To(gbytes.Say("ERROR 500 | PUT /v2/service_instances/1"))
+	})
+
+	It("logs classes without a level at info", func() {
+		status = http.StatusFound
+		logger.Println("302 | GET /dashboard")
+
+		Expect(string(logBuffer.Contents())).To(Equal("302 | GET /dashboard\n"))
+	})
+
+	It("parses status levels", func() {
+		Expect(logging.ParseStatusLevels("2xx=debug, 4XX=info,5xx=error")).To(Equal(levels))
+
+		_, err := logging.ParseStatusLevels("500=error")
+		Expect(err).To(MatchError("Invalid status level: 500=error"))
+		_, err = logging.ParseStatusLevels("5xx=loud")
+		Expect(err).To(MatchError("Unknown log level: loud"))
+	})
+})
+
+var _ = Describe("WithFields", func() {
+	var logBuffer *gbytes.Buffer
+
+	BeforeEach(func() {
+		logBuffer = gbytes.NewBuffer()
+	})
+
+	It("appends the fields to each line", func() {
+		logger := logging.WithFields(log.New(logBuffer, "", 0), func() string { return "instance_id=inst-1 plan_id=50%" })
+
+		logger.Printf("200 | GET /v2/service_instances/inst-1 | \t 1ms \n")
+		logger.Println("done")
+
+		Expect(string(logBuffer.Contents())).To(Equal("200 | GET /v2/service_instances/inst-1 | \t 1ms | instance_id=inst-1 plan_id=50% \ndone instance_id=inst-1 plan_id=50%\n"))
+	})
+
+	It("looks the fields up as each line is logged", func() {
+		fields := ""
+		logger := logging.WithFields(log.New(logBuffer, "", 0), func() string { return fields })
+
+		logger.Printf("200 | PUT /v2/service_instances/inst-1 \n")
+		fields = "plan_id=small"
+		logger.Printf("200 | PUT /v2/service_instances/inst-1 \n")
+
+		Expect(string(logBuffer.Contents())).To(Equal("200 | PUT /v2/service_instances/inst-1 \n200 | PUT /v2/service_instances/inst-1 | plan_id=small \n"))
+	})
+})
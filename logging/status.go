@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/negroni"
+)
+
+// StatusLevels maps the class of a response status, 2 for 2xx and so on, to
+// the level its request is logged at. Classes missing from it are logged at
+// Info.
+type StatusLevels map[int]Level
+
+// ParseStatusLevels parses a comma separated list of classes and levels, e.g.
+// "2xx=debug,4xx=info,5xx=error".
+func ParseStatusLevels(s string) (StatusLevels, error) {
+	levels := StatusLevels{}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		class := strings.ToLower(parts[0])
+		if len(parts) != 2 || len(class) != 3 || class[0] < '1' || class[0] > '5' || class[1:] != "xx" {
+			return nil, fmt.Errorf("Invalid status level: %s", pair)
+		}
+
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[int(class[0]-'0')] = level
+	}
+	return levels, nil
+}
+
+func (s StatusLevels) For(status int) Level {
+	if level, ok := s[status/100]; ok {
+		return level
+	}
+	return Info
+}
+
+// StatusLogger logs through logger at the level levels assign to the status
+// returned by status, which is only asked once a line is logged, i.e. after
+// the response was written. Lines below the current level are dropped.
+func StatusLogger(logger negroni.ALogger, levels StatusLevels, status func() int) negroni.ALogger {
+	return statusLogger{logger: logger, levels: levels, status: status}
+}
+
+type statusLogger struct {
+	logger negroni.ALogger
+	levels StatusLevels
+	status func() int
+}
+
+func (l statusLogger) Println(v ...interface{}) {
+	level := l.levels.For(l.status())
+	if !Enabled(level) {
+		return
+	}
+	if prefix, ok := prefixes[level]; ok {
+		v = append([]interface{}{strings.TrimSpace(prefix)}, v...)
+	}
+	l.logger.Println(v...)
+}
+
+func (l statusLogger) Printf(format string, v ...interface{}) {
+	if level := l.levels.For(l.status()); Enabled(level) {
+		l.logger.Printf(prefixes[level]+format, v...)
+	}
+}
@@ -1,18 +1,42 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/urfave/negroni"
 
+	"code.cloudfoundry.org/gcp-broker-proxy/audit"
 	"code.cloudfoundry.org/gcp-broker-proxy/auth"
+	"code.cloudfoundry.org/gcp-broker-proxy/catalog"
+	"code.cloudfoundry.org/gcp-broker-proxy/config"
+	"code.cloudfoundry.org/gcp-broker-proxy/fault"
+	"code.cloudfoundry.org/gcp-broker-proxy/health"
+	"code.cloudfoundry.org/gcp-broker-proxy/httpcache"
+	"code.cloudfoundry.org/gcp-broker-proxy/httpclient"
+	"code.cloudfoundry.org/gcp-broker-proxy/logging"
+	"code.cloudfoundry.org/gcp-broker-proxy/metrics"
 	"code.cloudfoundry.org/gcp-broker-proxy/oauth"
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+	"code.cloudfoundry.org/gcp-broker-proxy/params"
 	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+	"code.cloudfoundry.org/gcp-broker-proxy/ratelimit"
+	"code.cloudfoundry.org/gcp-broker-proxy/recorder"
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+	"code.cloudfoundry.org/gcp-broker-proxy/server"
+	"code.cloudfoundry.org/gcp-broker-proxy/snapshot"
 	"code.cloudfoundry.org/gcp-broker-proxy/startupchecker"
 	"code.cloudfoundry.org/gcp-broker-proxy/token"
 )
@@ -25,42 +49,437 @@ func main() {
 
 	username, password, brokerURLString, serviceAccountJSON := getRequiredEnvs()
 
-	brokerURL, err := url.ParseRequestURI(brokerURLString)
+	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
+		level, err := logging.ParseLevel(logLevel)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("LOG_LEVEL must be one of debug, info, warn or error: %s", logLevel))
+		}
+		logging.SetLevel(level)
+	}
+
+	if redactedQueryParams := os.Getenv("REDACT_QUERY_PARAMS"); redactedQueryParams != "" {
+		var names []string
+		for _, name := range strings.Split(redactedQueryParams, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+		redact.SetQueryParams(names...)
+	}
+
+	var fileConfig config.Config
+	var configWatcher *config.Watcher
+	var client *http.Client
+	var brokerProxy *proxy.Reloadable
+	var extraBrokers []*extraBroker
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		var err error
+		configWatcher, err = config.NewWatcher(configFile, func(cfg config.Config) {
+			// The client is only replaced for new timeouts, keeping its
+			// connections otherwise.
+			old := client
+			newClients := cfg.Timeouts != fileConfig.Timeouts
+			if newClients {
+				client = newBrokerClient(cfg)
+			}
+			fileConfig = cfg
+			brokerProxy.Reload(append(cfg.ProxyOptions(), proxy.WithHTTPDoer(proxyDoer(client)))...)
+			if client != old {
+				old.CloseIdleConnections()
+			}
+			for _, broker := range extraBrokers {
+				broker.reload(cfg, newClients)
+			}
+		})
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to load CONFIG_FILE: %s", err))
+		}
+		fileConfig = configWatcher.Config()
+		if fileConfig.BrokerURL != "" {
+			brokerURLString = fileConfig.BrokerURL
+		}
+	}
+	if brokerURLString == "" {
+		log.Fatal("Missing BROKER_URL environment variable(s)")
+	}
+
+	var err error
+	brokerURL, err = url.ParseRequestURI(brokerURLString)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("BROKER_URL must be a valid URL: %s", brokerURLString))
 	}
 
-	tokenFetcher, err := oauth.NewGCPOAuth(serviceAccountJSON)
-	if err != nil {
-		log.Fatal(fmt.Sprintf("Invalid SERVICE_ACCOUNT_JSON: %s", err))
+	// Without token injection tokenFetcher stays nil, which the token handler
+	// and the startup checks treat as a broker needing no token.
+	var tokenFetcher token.TokenRetriever
+	if os.Getenv("INJECT_TOKEN") != "false" {
+		tokenFetcher, err = newTokenRetriever(serviceAccountJSON)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Invalid SERVICE_ACCOUNT_JSON: %s", err))
+		}
 	}
 
-	client := http.Client{}
+	if rateLimit := os.Getenv("BROKER_RATE_LIMIT"); rateLimit != "" {
+		perSecond, err := strconv.ParseFloat(rateLimit, 64)
+		if err != nil || perSecond <= 0 {
+			log.Fatal(fmt.Sprintf("BROKER_RATE_LIMIT must be a positive number: %s", rateLimit))
+		}
+		brokerRateLimiter = ratelimit.New(perSecond, int(getIntEnv("BROKER_RATE_BURST")))
+	}
 
-	startupChecker := startupchecker.NewChecker(brokerURL, tokenFetcher, &client)
+	client = newBrokerClient(fileConfig)
 
-	err = startupChecker.Perform()
-	if err != nil {
-		log.Fatal("Failed startup checks: " + err.Error())
+	readiness := health.NewReadiness()
+	var healthHandler http.Handler
+	if os.Getenv("ENABLE_HEALTH") == "true" {
+		healthHandler = newHealthHandler(tokenFetcher, brokerDoer(client))
+	}
+	if adminPort := os.Getenv("ADMIN_PORT"); adminPort != "" {
+		admin := http.NewServeMux()
+		admin.Handle(health.ReadyPath, readiness)
+		if healthHandler != nil {
+			admin.Handle(health.Path, healthHandler)
+		}
+		go func() {
+			log.Fatal(http.ListenAndServe(":"+adminPort, admin))
+		}()
+	}
+
+	versionBrokers, serviceBrokers := os.Getenv("API_VERSION_BROKERS"), os.Getenv("SERVICE_BROKERS")
+	if versionBrokers != "" && serviceBrokers != "" {
+		log.Fatal("SERVICE_BROKERS cannot be combined with API_VERSION_BROKERS")
+	}
+	var (
+		versionTargets map[string]*extraBroker
+		serviceTargets []serviceBroker
+	)
+	if serviceBrokers != "" {
+		serviceTargets = getServiceBrokers(serviceBrokers, fileConfig)
+		for _, broker := range serviceTargets {
+			extraBrokers = append(extraBrokers, broker.extraBroker)
+		}
+	} else if versionBrokers != "" {
+		versionTargets = getVersionBrokers(versionBrokers, fileConfig)
+		for _, broker := range versionTargets {
+			extraBrokers = append(extraBrokers, broker)
+		}
+	}
+
+	startupTimeout := getDurationEnv("STARTUP_TIMEOUT")
+	if startupTimeout <= 0 {
+		startupTimeout = startupchecker.DefaultTimeout
+	}
+	startupOpts := []startupchecker.Option{
+		startupchecker.WithWarmConnections(int(getIntEnv("BROKER_WARM_CONNECTIONS"))),
+		startupchecker.WithAPIVersion(getCatalogAPIVersion(fileConfig)),
+	}
+	checkers := []startupchecker.Checker{startupchecker.NewChecker(brokerURL, tokenFetcher, brokerDoer(client), startupOpts...)}
+	for _, broker := range extraBrokers {
+		tr := broker.tokenRetriever
+		if tr == nil {
+			tr = tokenFetcher
+		}
+		checkers = append(checkers, startupchecker.NewChecker(broker.url, tr, brokerDoer(broker.client), startupOpts...))
+	}
+
+	startupConcurrency := int(getIntEnv("STARTUP_CHECK_CONCURRENCY"))
+	if startupConcurrency <= 0 {
+		startupConcurrency = 4
+	}
+	var failed int
+	for _, result := range startupchecker.PerformAll(checkers, startupConcurrency, startupTimeout) {
+		if !result.OK() {
+			log.Printf("Failed startup checks for %s: %s\n", result.BrokerURL.Redacted(), result.Err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatal(fmt.Sprintf("Failed startup checks for %d of %d brokers", failed, len(checkers)))
 	}
 	fmt.Println("Startup checks passed")
+	readiness.MarkReady()
 
 	basicAuth := auth.BasicAuth(username, password)
-	reverseProxy := proxy.ReverseProxy(brokerURL)
-	tokenHandler := token.TokenHandler(tokenFetcher)
+	adminUsername, adminPassword := os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")
+	if adminUsername != "" && adminPassword != "" {
+		basicAuth = auth.AdminAuth(adminUsername, adminPassword, basicAuth)
+	}
+	if hmacSecret := os.Getenv("HMAC_SECRET"); hmacSecret != "" {
+		hmacAuth := auth.HMACAuth([]byte(hmacSecret), getDurationEnv("HMAC_FRESHNESS_WINDOW"))
+		checkCredentials := basicAuth
+		basicAuth = func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+			hmacAuth(w, r, func(w http.ResponseWriter, r *http.Request) {
+				checkCredentials(w, r, next)
+			})
+		}
+	}
+	if allowedSources := os.Getenv("ALLOWED_SOURCE_CIDRS"); allowedSources != "" {
+		allowed, err := auth.ParseCIDRs(allowedSources)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("ALLOWED_SOURCE_CIDRS must be a comma separated list of CIDRs: %s", err))
+		}
+		allowlist := auth.SourceAllowlist(allowed, int(getIntEnv("TRUSTED_PROXY_HOPS")))
+		checkCredentials := basicAuth
+		basicAuth = func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+			allowlist(w, r, func(w http.ResponseWriter, r *http.Request) {
+				checkCredentials(w, r, next)
+			})
+		}
+	}
+	// Settings from the environment are read once, the config file's are
+	// reapplied on every reload.
+	brokerProxy = proxy.NewReloadable(brokerURL, getProxyOptions(proxyDoer(client))...)
+	brokerProxy.Reload(fileConfig.ProxyOptions()...)
+	reverseProxy := negroni.HandlerFunc(brokerProxy.ServeHTTP)
+	tokenHandler := token.TokenHandler(tokenFetcher, getTokenOptions()...)
+	if tenantServiceAccounts := os.Getenv("TENANT_SERVICE_ACCOUNTS"); tenantServiceAccounts != "" {
+		tokenHandler = token.SelectingTokenHandler(getTenantSelector(tenantServiceAccounts, tokenFetcher), getTokenOptions()...)
+	}
 
 	n := negroni.New()
 
 	logger := negroni.NewLogger()
 	logger.SetFormat("{{.Status}} | {{.Method}} {{.Path}} {{.Request.URL.RawQuery}} | \t {{.Duration}} \n")
 
-	n.Use(logger)
+	var statusLevels logging.StatusLevels
+	if logLevels := os.Getenv("LOG_LEVEL_BY_STATUS"); logLevels != "" {
+		if statusLevels, err = logging.ParseStatusLevels(logLevels); err != nil {
+			log.Fatal(fmt.Sprintf("LOG_LEVEL_BY_STATUS must be a comma separated list like 2xx=debug,5xx=error: %s", err))
+		}
+	}
+	var attributeBodyBytes int64
+	if os.Getenv("LOG_OSB_ATTRIBUTES") == "true" {
+		attributeBodyBytes = getIntEnv("LOG_ATTRIBUTE_BODY_BYTES")
+		if attributeBodyBytes == 0 {
+			attributeBodyBytes = osb.DefaultMaxAttributeBodyBytes
+		}
+	}
+	n.Use(logRedacted(logger, statusLevels, attributeBodyBytes))
+	n.Use(proxy.Recover(brokerErrors))
+	if os.Getenv("HANDLE_PREFLIGHT") == "true" {
+		var origins []string
+		if corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS"); corsOrigins != "" {
+			for _, origin := range strings.Split(corsOrigins, ",") {
+				origins = append(origins, strings.TrimSpace(origin))
+			}
+		}
+		n.Use(proxy.Preflight(origins))
+	}
 	n.Use(basicAuth)
-	n.Use(tokenHandler)
-	n.Use(reverseProxy)
+	if os.Getenv("METHOD_OVERRIDE") == "true" {
+		n.Use(proxy.MethodOverride())
+	}
+
+	mux := newAdminRoutes(n)
+	snap := snapshot.New()
+
+	if instanceRateLimit := os.Getenv("INSTANCE_RATE_LIMIT"); instanceRateLimit != "" {
+		perSecond, err := strconv.ParseFloat(instanceRateLimit, 64)
+		if err != nil || perSecond <= 0 {
+			log.Fatal(fmt.Sprintf("INSTANCE_RATE_LIMIT must be a positive number: %s", instanceRateLimit))
+		}
+		n.Use(ratelimit.NewInstanceLimiter(perSecond, int(getIntEnv("INSTANCE_RATE_BURST")), int(getIntEnv("INSTANCE_RATE_LIMITERS"))).Middleware())
+	}
+
+	if maxConcurrent := getIntEnv("MAX_CONCURRENT_REQUESTS"); maxConcurrent > 0 {
+		queueTimeout := getDurationEnv("REQUEST_QUEUE_TIMEOUT")
+		if queueTimeout <= 0 {
+			queueTimeout = 10 * time.Second
+		}
+		var queueOpts []ratelimit.QueueOption
+		if os.Getenv("PRIORITIZE_OPERATIONS") == "true" {
+			queueOpts = append(queueOpts, ratelimit.WithPriority(ratelimit.OperationPriority))
+		}
+		n.Use(ratelimit.NewQueue(int(maxConcurrent), int(getIntEnv("REQUEST_QUEUE_SIZE")), queueTimeout, queueOpts...).Middleware())
+	}
+
+	requestMetrics := metrics.New()
+	if os.Getenv("ENABLE_METRICS") == "true" || os.Getenv("ENABLE_SNAPSHOT") == "true" {
+		n.Use(requestMetrics.Middleware())
+	}
+
+	if size := getIntEnv("RECORD_REQUESTS"); size > 0 {
+		if adminUsername == "" || adminPassword == "" {
+			log.Fatal("RECORD_REQUESTS requires ADMIN_USERNAME and ADMIN_PASSWORD")
+		}
+		requestRecorder := recorder.New(int(size))
+		n.Use(requestRecorder.Middleware())
+		mux.Handle(recorder.Path, negroni.New(basicAuth, auth.RequireAdmin(), negroni.Wrap(requestRecorder)))
+	}
+
+	if auditLogPath := os.Getenv("AUDIT_LOG"); auditLogPath != "" {
+		auditLog, err := os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to open AUDIT_LOG: %s", err))
+		}
+		defer auditLog.Close()
+		n.Use(audit.New(auditLog).Middleware())
+	}
+
+	catalogTTL, catalogMaxStale := getDurationEnv("CATALOG_CACHE_TTL"), getDurationEnv("CATALOG_MAX_STALENESS")
+	if catalogTTL > 0 || catalogMaxStale > 0 {
+		var catalogOpts []catalog.Option
+		if os.Getenv("VALIDATE_CATALOG") == "true" {
+			catalogOpts = append(catalogOpts, catalog.WithValidation())
+		}
+		catalogCache := catalog.NewCache(catalogTTL, catalogMaxStale, catalogOpts...)
+		snap.Add("catalog_cache", func() interface{} { return catalogCache.Stats() })
+		n.Use(catalogCache.Middleware())
+	}
+
+	if cachePaths := os.Getenv("GET_CACHE_PATHS"); cachePaths != "" {
+		var patterns []string
+		for _, pattern := range strings.Split(cachePaths, ",") {
+			patterns = append(patterns, strings.TrimSpace(pattern))
+		}
+		cacheTTL := getDurationEnv("GET_CACHE_TTL")
+		if cacheTTL <= 0 {
+			cacheTTL = time.Minute
+		}
+		var cacheOpts []httpcache.Option
+		if maxEntries := getIntEnv("GET_CACHE_MAX_ENTRIES"); maxEntries > 0 {
+			cacheOpts = append(cacheOpts, httpcache.WithMaxEntries(int(maxEntries)))
+		}
+		getCache := httpcache.New(cacheTTL, patterns, cacheOpts...)
+		snap.Add("get_cache", func() interface{} { return getCache.Stats() })
+		n.Use(getCache.Middleware())
+	}
+
+	maxParametersBytes, maxParametersDepth := getIntEnv("MAX_PARAMETERS_BYTES"), getIntEnv("MAX_PARAMETERS_DEPTH")
+	if maxParametersBytes > 0 || maxParametersDepth > 0 {
+		n.Use(params.Limit(int(maxParametersBytes), int(maxParametersDepth)))
+	}
+
+	if injectParameters := os.Getenv("INJECT_PARAMETERS"); injectParameters != "" {
+		var fragment map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(injectParameters))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fragment); err != nil {
+			log.Fatal(fmt.Sprintf("INJECT_PARAMETERS must be a JSON object: %s", err))
+		}
+		n.Use(params.Inject(fragment, os.Getenv("INJECT_PARAMETERS_OVERWRITE") == "true"))
+	}
+
+	if faultInjection := os.Getenv("FAULT_INJECTION"); faultInjection != "" {
+		if os.Getenv("FAULT_INJECTION_NOT_FOR_PRODUCTION") != "true" {
+			log.Fatal("FAULT_INJECTION requires FAULT_INJECTION_NOT_FOR_PRODUCTION=true")
+		}
+		var faults fault.Config
+		if err := json.Unmarshal([]byte(faultInjection), &faults); err != nil {
+			log.Fatal(fmt.Sprintf("FAULT_INJECTION must be a JSON object: %s", err))
+		}
+		fmt.Println("WARNING: injecting faults into requests to the broker")
+		n.Use(fault.New(faults).Middleware())
+	}
+
+	if overrideHosts := os.Getenv("BROKER_OVERRIDE_HOSTS"); overrideHosts != "" {
+		if adminUsername == "" || adminPassword == "" {
+			log.Fatal("BROKER_OVERRIDE_HOSTS requires ADMIN_USERNAME and ADMIN_PASSWORD")
+		}
+		var hosts []string
+		for _, host := range strings.Split(overrideHosts, ",") {
+			hosts = append(hosts, strings.TrimSpace(host))
+		}
+		override := proxy.BrokerOverride(hosts, proxy.WithHTTPDoer(proxyDoer(client)), proxy.WithErrorCounter(brokerErrors))
+		n.UseFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+			if r.Header.Get(proxy.BrokerOverrideHeader) == "" {
+				next(w, r)
+				return
+			}
+			tokenHandler(w, r, func(w http.ResponseWriter, r *http.Request) {
+				override(w, r, next)
+			})
+		})
+	}
+
+	// brokers serves requests past basic auth, and the catalog poller.
+	brokers := negroni.New(tokenHandler, reverseProxy)
+	if serviceTargets != nil {
+		brokers = negroni.New(proxy.ByService(getServiceRoutes(serviceTargets, tokenHandler), brokers, getBodyOptions()...))
+	} else if versionTargets != nil {
+		brokers = negroni.New(proxy.ByAPIVersion(getVersionHandlers(versionTargets, tokenHandler), brokers))
+	}
+	n.UseHandler(brokers)
+
+	srv := server.New(":"+port, mux, getServerOptions()...)
+
+	mux.Handle(health.ReadyPath, readiness)
+	if healthHandler != nil {
+		mux.Handle(health.Path, negroni.New(basicAuth, negroni.Wrap(healthHandler)))
+	}
+
+	if os.Getenv("ENABLE_SNAPSHOT") == "true" {
+		if adminUsername == "" || adminPassword == "" {
+			log.Fatal("ENABLE_SNAPSHOT requires ADMIN_USERNAME and ADMIN_PASSWORD")
+		}
+		if tokenFetcher != nil {
+			snap.Add("token", func() interface{} {
+				t, err := tokenFetcher.GetToken()
+				if err != nil {
+					return map[string]string{"error": redact.Error(err, nil).Error()}
+				}
+				return map[string]interface{}{"expiry": t.Expiry}
+			})
+		}
+		snap.Add("in_flight", func() interface{} {
+			reads, mutating := srv.InFlight()
+			return map[string]int{"reads": reads, "mutating": mutating}
+		})
+		snap.Add("errors", func() interface{} { return brokerErrors.Counts() })
+		snap.Add("requests", func() interface{} { return requestMetrics.Series() })
+		mux.Handle(snapshot.Path, negroni.New(basicAuth, auth.RequireAdmin(), negroni.Wrap(snap)))
+	}
+
+	if os.Getenv("ENABLE_METRICS") == "true" {
+		if adminUsername == "" || adminPassword == "" {
+			log.Fatal("ENABLE_METRICS requires ADMIN_USERNAME and ADMIN_PASSWORD")
+		}
+		mux.Handle(metrics.Path, negroni.New(basicAuth, auth.RequireAdmin(), negroni.Wrap(requestMetrics)))
+	}
+
+	if configWatcher != nil {
+		go func() {
+			reloads := make(chan os.Signal, 1)
+			signal.Notify(reloads, syscall.SIGHUP)
+			for range reloads {
+				if err := configWatcher.Reload(); err != nil {
+					log.Println("Failed to reload CONFIG_FILE: " + err.Error())
+				}
+			}
+		}()
+		go configWatcher.Poll(5*time.Second, nil)
+	}
+
+	stopPolling := make(chan struct{})
+	if sinkURL := os.Getenv("CATALOG_SINK_URL"); sinkURL != "" {
+		if _, err := url.ParseRequestURI(sinkURL); err != nil {
+			log.Fatal(fmt.Sprintf("CATALOG_SINK_URL must be a valid URL: %s", sinkURL))
+		}
+		pollInterval := getDurationEnv("CATALOG_POLL_INTERVAL")
+		if pollInterval <= 0 {
+			pollInterval = 5 * time.Minute
+		}
+		sink := catalog.WebhookSink(&http.Client{Timeout: 30 * time.Second}, sinkURL)
+		go catalog.NewPoller(brokers, getCatalogAPIVersion(fileConfig), sink).Poll(pollInterval, stopPolling)
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		<-signals
+
+		fmt.Println("Shutting down")
+		close(stopPolling)
+		if err := srv.Shutdown(); err != nil {
+			log.Println("Failed to drain in-flight requests: " + err.Error())
+		}
+		close(shutdown)
+	}()
 
 	fmt.Printf("About to listen on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, n))
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdown
 }
 
 func getRequiredEnvs() (username, password, brokerURL, serviceAccountJSON string) {
@@ -76,8 +495,16 @@ func getRequiredEnvs() (username, password, brokerURL, serviceAccountJSON string
 
 	username = getRequiredEnv("USERNAME")
 	password = getRequiredEnv("PASSWORD")
-	brokerURL = getRequiredEnv("BROKER_URL")
-	serviceAccountJSON = getRequiredEnv("SERVICE_ACCOUNT_JSON")
+	if os.Getenv("CONFIG_FILE") == "" {
+		brokerURL = getRequiredEnv("BROKER_URL")
+	} else {
+		brokerURL = os.Getenv("BROKER_URL")
+	}
+	if os.Getenv("INJECT_TOKEN") == "false" {
+		serviceAccountJSON = os.Getenv("SERVICE_ACCOUNT_JSON")
+	} else {
+		serviceAccountJSON = getRequiredEnv("SERVICE_ACCOUNT_JSON")
+	}
 
 	if len(missingEnvs) != 0 {
 		errMsg := fmt.Sprintf("Missing %s environment variable(s)", strings.Join(missingEnvs, ", "))
@@ -86,3 +513,732 @@ func getRequiredEnvs() (username, password, brokerURL, serviceAccountJSON string
 
 	return
 }
+
+var (
+	brokerURL         *url.URL
+	brokerRateLimiter *ratelimit.Limiter
+	brokerErrors      = proxy.NewErrorCounter()
+	idTokens          = map[string]*oauth.GCPIDTokens{}
+)
+
+// newBrokerClient builds the client used for the broker. Settings from the
+// config file take precedence over environment variables.
+func newBrokerClient(cfg config.Config) *http.Client {
+	return httpclient.New(append(getHTTPClientOptions(), cfg.HTTPClientOptions()...)...)
+}
+
+// brokerDoer sends requests through client within BROKER_RATE_LIMIT.
+func brokerDoer(client *http.Client) proxy.HTTPDoer {
+	if brokerRateLimiter != nil {
+		return ratelimit.NewDoer(client, brokerRateLimiter)
+	}
+	return client
+}
+
+// proxyDoer is brokerDoer for the reverse proxies, which pass redirects from
+// the broker on to their clients.
+func proxyDoer(client *http.Client) proxy.HTTPDoer {
+	return brokerDoer(httpclient.WithoutRedirects(client))
+}
+
+// getDefaultAPIVersion is the OSB API version used where the proxy has no
+// request to take one from. The config file takes precedence over
+// DEFAULT_API_VERSION.
+func getDefaultAPIVersion(cfg config.Config) string {
+	if cfg.APIVersion != "" {
+		return cfg.APIVersion
+	}
+	if defaultAPIVersion := os.Getenv("DEFAULT_API_VERSION"); defaultAPIVersion != "" {
+		return defaultAPIVersion
+	}
+	return "2.14"
+}
+
+// getCatalogAPIVersion is the OSB API version the proxy fetches the catalog
+// with on its own, for the startup checks and CATALOG_SINK_URL.
+func getCatalogAPIVersion(cfg config.Config) string {
+	if apiVersion := os.Getenv("CATALOG_POLL_API_VERSION"); apiVersion != "" {
+		return apiVersion
+	}
+	return getDefaultAPIVersion(cfg)
+}
+
+func getProxyOptions(client proxy.HTTPDoer) []proxy.Option {
+	opts := []proxy.Option{proxy.WithHTTPDoer(client), proxy.WithErrorCounter(brokerErrors)}
+
+	if maxResponseBytes := getIntEnv("MAX_RESPONSE_BYTES"); maxResponseBytes > 0 {
+		opts = append(opts, proxy.WithMaxResponseBytes(maxResponseBytes))
+	}
+
+	if os.Getenv("ENFORCE_JSON_CONTENT_TYPE") == "true" {
+		opts = append(opts, proxy.WithJSONContentType())
+	}
+
+	if dashboardURL := os.Getenv("DASHBOARD_EXTERNAL_URL"); dashboardURL != "" {
+		externalURL, err := url.ParseRequestURI(dashboardURL)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("DASHBOARD_EXTERNAL_URL must be a valid URL: %s", dashboardURL))
+		}
+		opts = append(opts, proxy.WithDashboardURL(externalURL))
+	}
+
+	if bodyReplacements := os.Getenv("RESPONSE_BODY_REPLACEMENTS"); bodyReplacements != "" {
+		var replacements []proxy.BodyReplacement
+		if err := json.Unmarshal([]byte(bodyReplacements), &replacements); err != nil {
+			log.Fatal(fmt.Sprintf("RESPONSE_BODY_REPLACEMENTS must be a JSON array of replacements: %s", err))
+		}
+		for _, replacement := range replacements {
+			if _, err := path.Match(replacement.Endpoint, ""); err != nil || replacement.Endpoint == "" {
+				log.Fatal(fmt.Sprintf("RESPONSE_BODY_REPLACEMENTS contains an invalid endpoint pattern: %q", replacement.Endpoint))
+			}
+			if len(replacement.Path) == 0 || (len(replacement.Value) == 0 && replacement.Find == "") {
+				log.Fatal("RESPONSE_BODY_REPLACEMENTS entries need a path and either a value or find")
+			}
+		}
+		opts = append(opts, proxy.WithBodyReplacements(replacements...))
+	}
+
+	if slowRequestThreshold := getDurationEnv("SLOW_REQUEST_THRESHOLD"); slowRequestThreshold > 0 {
+		opts = append(opts, proxy.WithSlowRequestLog(slowRequestThreshold))
+	}
+
+	if fallbackURLs := os.Getenv("BROKER_FALLBACK_URLS"); fallbackURLs != "" {
+		var fallbacks []*url.URL
+		for _, fallbackURL := range strings.Split(fallbackURLs, ",") {
+			fallback, err := url.ParseRequestURI(strings.TrimSpace(fallbackURL))
+			if err != nil {
+				log.Fatal(fmt.Sprintf("BROKER_FALLBACK_URLS must be a comma separated list of URLs: %s", fallbackURLs))
+			}
+			fallbacks = append(fallbacks, fallback)
+		}
+		opts = append(opts, proxy.WithFallbackBrokers(int(getIntEnv("BROKER_MAX_ATTEMPTS")), fallbacks...))
+	}
+
+	switch trailingSlash := os.Getenv("TRAILING_SLASH"); trailingSlash {
+	case "", "exact":
+	case "strip":
+		opts = append(opts, proxy.WithTrailingSlash(proxy.TrailingSlashStrip))
+	case "keep":
+		opts = append(opts, proxy.WithTrailingSlash(proxy.TrailingSlashKeep))
+	default:
+		log.Fatal(fmt.Sprintf("TRAILING_SLASH must be one of exact, strip or keep: %s", trailingSlash))
+	}
+
+	if os.Getenv("COLLAPSE_SLASHES") == "true" {
+		opts = append(opts, proxy.WithCollapsedSlashes())
+	}
+
+	if os.Getenv("RETRY_ASYNC_REQUIRED") == "true" {
+		opts = append(opts, proxy.WithAsyncRequiredRetry())
+	}
+
+	if statusMapping := os.Getenv("STATUS_MAPPING"); statusMapping != "" {
+		var mappings []proxy.StatusMapping
+		if err := json.Unmarshal([]byte(statusMapping), &mappings); err != nil {
+			log.Fatal(fmt.Sprintf("STATUS_MAPPING must be a JSON array of mappings: %s", err))
+		}
+		opts = append(opts, proxy.WithStatusMapping(mappings...))
+	}
+
+	switch missingAPIVersion := os.Getenv("MISSING_API_VERSION"); missingAPIVersion {
+	case "", "pass":
+	case "inject":
+		opts = append(opts, proxy.WithMissingAPIVersion(proxy.MissingAPIVersionInject, getDefaultAPIVersion(config.Config{})))
+	case "reject":
+		opts = append(opts, proxy.WithMissingAPIVersion(proxy.MissingAPIVersionReject, ""))
+	default:
+		log.Fatal(fmt.Sprintf("MISSING_API_VERSION must be one of pass, inject or reject: %s", missingAPIVersion))
+	}
+
+	if os.Getenv("GUARD_INSTANCE_CONCURRENCY") == "true" {
+		opts = append(opts, proxy.WithInstanceConcurrencyGuard())
+	}
+
+	if retryBudget := getDurationEnv("BROKER_RETRY_BUDGET"); retryBudget > 0 {
+		opts = append(opts, proxy.WithRetryBudget(retryBudget))
+	}
+
+	if os.Getenv("B3_PROPAGATION") == "true" {
+		opts = append(opts, proxy.WithB3Propagation())
+	}
+
+	opts = append(opts, getBodyOptions()...)
+
+	if emptyBodyDefaults := os.Getenv("EMPTY_BODY_DEFAULTS"); emptyBodyDefaults != "" {
+		var operations []osb.Operation
+		for _, name := range strings.Split(emptyBodyDefaults, ",") {
+			operation := osb.Operation(strings.TrimSpace(name))
+			switch operation {
+			case osb.Catalog, osb.GetInstance, osb.GetBinding, osb.LastOperation, osb.BindingLastOperation:
+			default:
+				log.Fatal(fmt.Sprintf("EMPTY_BODY_DEFAULTS must be a comma separated list of catalog, get_instance, get_binding, last_operation or binding_last_operation: %s", emptyBodyDefaults))
+			}
+			operations = append(operations, operation)
+		}
+		opts = append(opts, proxy.WithEmptyBodyDefaults(operations...))
+	}
+
+	if responseHeaders := os.Getenv("RESPONSE_HEADERS"); responseHeaders != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(responseHeaders), &headers); err != nil {
+			log.Fatal(fmt.Sprintf("RESPONSE_HEADERS must be a JSON object of header names to values: %s", err))
+		}
+		opts = append(opts, proxy.WithResponseHeaders(headers, os.Getenv("RESPONSE_HEADERS_OVERRIDE") == "true"))
+	}
+
+	if largeResponseBytes := getIntEnv("LARGE_RESPONSE_WARNING_BYTES"); largeResponseBytes > 0 {
+		opts = append(opts, proxy.WithLargeResponseWarning(largeResponseBytes))
+	}
+
+	switch contentLengthMismatch := os.Getenv("CONTENT_LENGTH_MISMATCH"); contentLengthMismatch {
+	case "":
+	case "reject":
+		opts = append(opts, proxy.WithContentLengthCheck(proxy.ContentLengthReject))
+	case "recompute":
+		opts = append(opts, proxy.WithContentLengthCheck(proxy.ContentLengthRecompute))
+	default:
+		log.Fatal(fmt.Sprintf("CONTENT_LENGTH_MISMATCH must be one of reject or recompute: %s", contentLengthMismatch))
+	}
+
+	if os.Getenv("ATTEMPT_HEADERS") == "true" {
+		opts = append(opts, proxy.WithAttemptHeaders())
+	}
+
+	switch cookies := os.Getenv("COOKIES"); cookies {
+	case "", "strip":
+	case "preserve":
+		opts = append(opts, proxy.WithCookies(proxy.CookiesPreserve))
+	default:
+		log.Fatal(fmt.Sprintf("COOKIES must be one of strip or preserve: %s", cookies))
+	}
+
+	if retryAttempts := getIntEnv("BROKER_RETRY_ATTEMPTS"); retryAttempts > 1 {
+		var methods []string
+		if retryMethods := os.Getenv("BROKER_RETRY_METHODS"); retryMethods != "" {
+			for _, method := range strings.Split(retryMethods, ",") {
+				methods = append(methods, strings.ToUpper(strings.TrimSpace(method)))
+			}
+		}
+		opts = append(opts, proxy.WithRetries(int(retryAttempts), methods...))
+	}
+
+	if maxRetryAfter := getDurationEnv("BROKER_MAX_RETRY_AFTER"); maxRetryAfter > 0 {
+		opts = append(opts, proxy.WithRetryAfter(maxRetryAfter))
+	}
+
+	if redactDescriptions := os.Getenv("REDACT_ERROR_DESCRIPTIONS"); redactDescriptions != "" {
+		var expressions []string
+		if err := json.Unmarshal([]byte(redactDescriptions), &expressions); err != nil {
+			log.Fatal(fmt.Sprintf("REDACT_ERROR_DESCRIPTIONS must be a JSON array of regular expressions: %s", err))
+		}
+		patterns := make([]*regexp.Regexp, len(expressions))
+		for i, expression := range expressions {
+			pattern, err := regexp.Compile(expression)
+			if err != nil {
+				log.Fatal(fmt.Sprintf("REDACT_ERROR_DESCRIPTIONS contains an invalid regular expression: %s", err))
+			}
+			patterns[i] = pattern
+		}
+		opts = append(opts, proxy.WithErrorDescriptionRedaction(patterns...))
+	}
+
+	switch invalidJSONErrors := os.Getenv("INVALID_JSON_ERRORS"); invalidJSONErrors {
+	case "":
+	case "rewrite":
+		opts = append(opts, proxy.WithInvalidJSONErrors(proxy.InvalidJSONErrorRewrite))
+	case "content_type":
+		opts = append(opts, proxy.WithInvalidJSONErrors(proxy.InvalidJSONErrorContentType))
+	default:
+		log.Fatal(fmt.Sprintf("INVALID_JSON_ERRORS must be one of rewrite or content_type: %s", invalidJSONErrors))
+	}
+
+	if validateResponses := os.Getenv("VALIDATE_RESPONSES"); validateResponses != "" {
+		var operations []osb.Operation
+		for _, name := range strings.Split(validateResponses, ",") {
+			operation := osb.Operation(strings.TrimSpace(name))
+			switch operation {
+			case osb.Provision, osb.Update, osb.Deprovision, osb.Bind, osb.Unbind, osb.LastOperation, osb.BindingLastOperation:
+			default:
+				log.Fatal(fmt.Sprintf("VALIDATE_RESPONSES must be a comma separated list of provision, update, deprovision, bind, unbind, last_operation or binding_last_operation: %s", validateResponses))
+			}
+			operations = append(operations, operation)
+		}
+
+		validation := proxy.ResponseValidationLog
+		switch mode := os.Getenv("INVALID_RESPONSES"); mode {
+		case "", "log":
+		case "reject":
+			validation = proxy.ResponseValidationReject
+		default:
+			log.Fatal(fmt.Sprintf("INVALID_RESPONSES must be one of log or reject: %s", mode))
+		}
+		opts = append(opts, proxy.WithResponseValidation(validation, operations...))
+	}
+
+	if stuckOperationThreshold := getDurationEnv("STUCK_OPERATION_THRESHOLD"); stuckOperationThreshold > 0 {
+		opts = append(opts, proxy.WithStuckOperationWarning(stuckOperationThreshold))
+	}
+
+	if os.Getenv("CORRELATION_ID") == "true" {
+		opts = append(opts, proxy.WithCorrelationID())
+	}
+
+	if maxDecompressedBytes := getIntEnv("MAX_DECOMPRESSED_BYTES"); maxDecompressedBytes > 0 {
+		opts = append(opts, proxy.WithMaxDecompressedBytes(maxDecompressedBytes))
+	}
+
+	if deadlineHeader := os.Getenv("DEADLINE_HEADER"); deadlineHeader != "" {
+		opts = append(opts, proxy.WithDeadlineHeader(deadlineHeader))
+	}
+
+	if defaultAccept := os.Getenv("DEFAULT_ACCEPT"); defaultAccept != "" {
+		opts = append(opts, proxy.WithDefaultAccept(defaultAccept))
+	}
+
+	if defaultIdentity := os.Getenv("DEFAULT_ORIGINATING_IDENTITY"); defaultIdentity != "" {
+		var identity osb.OriginatingIdentity
+		if err := json.Unmarshal([]byte(defaultIdentity), &identity); err != nil || identity.Platform == "" || strings.ContainsAny(identity.Platform, " \t") {
+			log.Fatal(fmt.Sprintf("DEFAULT_ORIGINATING_IDENTITY must be a JSON object with a platform and a value: %s", defaultIdentity))
+		}
+		header, err := identity.Encode()
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Invalid DEFAULT_ORIGINATING_IDENTITY: %s", err))
+		}
+		opts = append(opts, proxy.WithDefaultOriginatingIdentity(header))
+	}
+
+	if copyBufferSize := getIntEnv("COPY_BUFFER_BYTES"); copyBufferSize > 0 {
+		opts = append(opts, proxy.WithCopyBufferSize(int(copyBufferSize)))
+	}
+
+	if clockSkewThreshold := getDurationEnv("CLOCK_SKEW_THRESHOLD"); clockSkewThreshold > 0 {
+		opts = append(opts, proxy.WithClockSkewWarning(clockSkewThreshold))
+	}
+
+	if os.Getenv("REQUIRE_QUERY_PARAMS") == "true" {
+		opts = append(opts, proxy.WithRequiredQueryParams())
+	}
+
+	if os.Getenv("SEND_ZERO_CONTENT_LENGTH") == "true" {
+		opts = append(opts, proxy.WithZeroContentLength())
+	}
+
+	return opts
+}
+
+// getBodyOptions are the options for reading request bodies, shared by the
+// reverse proxies and the service routing in front of them.
+func getBodyOptions() []proxy.Option {
+	var opts []proxy.Option
+
+	if maxReplayBodyBytes := getIntEnv("MAX_REPLAY_BODY_BYTES"); maxReplayBodyBytes > 0 {
+		opts = append(opts, proxy.WithMaxReplayBodyBytes(maxReplayBodyBytes))
+	}
+
+	if bodyReadTimeout := getDurationEnv("BODY_READ_TIMEOUT"); bodyReadTimeout > 0 {
+		opts = append(opts, proxy.WithBodyReadTimeout(bodyReadTimeout))
+	}
+
+	return opts
+}
+
+func newTokenRetriever(serviceAccountJSON string) (token.TokenRetriever, error) {
+	if audience := os.Getenv("IAP_AUDIENCE"); audience != "" {
+		return newIDTokenRetriever(serviceAccountJSON, audience)
+	}
+	return oauth.NewGCPOAuth(serviceAccountJSON, getOAuthOptions()...)
+}
+
+// newIDTokenRetriever shares one ID token cache per service account, so
+// brokers with the same service account and audience reuse the same token.
+func newIDTokenRetriever(serviceAccountJSON, audience string) (token.TokenRetriever, error) {
+	tokens, ok := idTokens[serviceAccountJSON]
+	if !ok {
+		var err error
+		tokens, err = oauth.NewGCPIDTokens(serviceAccountJSON, getOAuthOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		idTokens[serviceAccountJSON] = tokens
+	}
+
+	return tokens.ForAudience(audience), nil
+}
+
+func getOAuthOptions() []oauth.Option {
+	var opts []oauth.Option
+	if minTTL := getDurationEnv("TOKEN_MIN_TTL"); minTTL > 0 {
+		opts = append(opts, oauth.WithMinTTL(minTTL))
+	}
+
+	return opts
+}
+
+func getTenantSelector(tenantServiceAccounts string, fallback token.TokenRetriever) token.Selector {
+	var serviceAccounts map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(tenantServiceAccounts), &serviceAccounts); err != nil {
+		log.Fatal(fmt.Sprintf("TENANT_SERVICE_ACCOUNTS must be a JSON object: %s", err))
+	}
+
+	tenants := map[string]token.TokenRetriever{}
+	for tenant, serviceAccountJSON := range serviceAccounts {
+		tr, err := newTokenRetriever(string(serviceAccountJSON))
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Invalid service account for tenant %s: %s", tenant, err))
+		}
+		tenants[tenant] = tr
+	}
+
+	if os.Getenv("TENANT_STRICT") == "true" {
+		fallback = nil
+	}
+
+	return token.TenantSelector(tenants, fallback)
+}
+
+// getVersionBrokers reads the brokers of API_VERSION_BROKERS, keyed by API
+// version.
+func getVersionBrokers(versionBrokers string, cfg config.Config) map[string]*extraBroker {
+	var configs map[string]brokerConfig
+	if err := json.Unmarshal([]byte(versionBrokers), &configs); err != nil {
+		log.Fatal(fmt.Sprintf("API_VERSION_BROKERS must be a JSON object: %s", err))
+	}
+
+	brokers := map[string]*extraBroker{}
+	for version, broker := range configs {
+		brokers[version] = newExtraBroker(broker, "API version "+version, cfg)
+	}
+
+	return brokers
+}
+
+// serviceBroker is a broker of SERVICE_BROKERS with the ids routed to it.
+type serviceBroker struct {
+	*extraBroker
+	serviceIDs []string
+	planIDs    []string
+}
+
+func getServiceBrokers(serviceBrokers string, cfg config.Config) []serviceBroker {
+	var configs []struct {
+		brokerConfig
+		ServiceIDs []string `json:"service_ids"`
+		PlanIDs    []string `json:"plan_ids"`
+	}
+	if err := json.Unmarshal([]byte(serviceBrokers), &configs); err != nil {
+		log.Fatal(fmt.Sprintf("SERVICE_BROKERS must be a JSON array: %s", err))
+	}
+
+	var brokers []serviceBroker
+	for _, broker := range configs {
+		brokers = append(brokers, serviceBroker{
+			extraBroker: newExtraBroker(broker.brokerConfig, broker.BrokerURL, cfg),
+			serviceIDs:  broker.ServiceIDs,
+			planIDs:     broker.PlanIDs,
+		})
+	}
+
+	return brokers
+}
+
+// getVersionHandlers builds a token handler and reverse proxy per API version.
+// Versions without their own service account use the default token handler.
+func getVersionHandlers(brokers map[string]*extraBroker, defaultTokenHandler negroni.HandlerFunc) map[string]http.Handler {
+	handlers := map[string]http.Handler{}
+	for version, broker := range brokers {
+		handlers[version] = broker.handler(defaultTokenHandler)
+	}
+
+	return handlers
+}
+
+func getServiceRoutes(brokers []serviceBroker, defaultTokenHandler negroni.HandlerFunc) []proxy.BrokerRoute {
+	var routes []proxy.BrokerRoute
+	for _, broker := range brokers {
+		routes = append(routes, proxy.BrokerRoute{
+			ServiceIDs: broker.serviceIDs,
+			PlanIDs:    broker.planIDs,
+			Handler:    broker.handler(defaultTokenHandler),
+		})
+	}
+
+	return routes
+}
+
+// brokerConfig describes a broker besides BROKER_URL, optionally with its own
+// service account and IAP audience.
+type brokerConfig struct {
+	BrokerURL          string          `json:"broker_url"`
+	ServiceAccountJSON json.RawMessage `json:"service_account_json"`
+	IAPAudience        string          `json:"iap_audience"`
+}
+
+// extraBroker is a broker besides BROKER_URL with the client and reverse
+// proxy used for it, which follow the config file like those of BROKER_URL.
+// A nil tokenRetriever leaves the token to the default token handler.
+type extraBroker struct {
+	url            *url.URL
+	tokenRetriever token.TokenRetriever
+	client         *http.Client
+	proxy          *proxy.Reloadable
+}
+
+func newExtraBroker(broker brokerConfig, name string, cfg config.Config) *extraBroker {
+	brokerURL, err := url.ParseRequestURI(broker.BrokerURL)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Invalid broker_url for %s: %s", name, broker.BrokerURL))
+	}
+
+	var tr token.TokenRetriever
+	if len(broker.ServiceAccountJSON) != 0 || broker.IAPAudience != "" {
+		serviceAccountJSON := string(broker.ServiceAccountJSON)
+		if serviceAccountJSON == "" {
+			serviceAccountJSON = os.Getenv("SERVICE_ACCOUNT_JSON")
+		}
+
+		if broker.IAPAudience != "" {
+			tr, err = newIDTokenRetriever(serviceAccountJSON, broker.IAPAudience)
+		} else {
+			tr, err = newTokenRetriever(serviceAccountJSON)
+		}
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Invalid service account for %s: %s", name, err))
+		}
+	}
+
+	client := newBrokerClient(cfg)
+	brokerProxy := proxy.NewReloadable(brokerURL, getProxyOptions(proxyDoer(client))...)
+	brokerProxy.Reload(cfg.ProxyOptions()...)
+
+	return &extraBroker{url: brokerURL, tokenRetriever: tr, client: client, proxy: brokerProxy}
+}
+
+// reload applies a reloaded config file, with a new client when newClient is
+// set.
+func (b *extraBroker) reload(cfg config.Config, newClient bool) {
+	old := b.client
+	if newClient {
+		b.client = newBrokerClient(cfg)
+	}
+	b.proxy.Reload(append(cfg.ProxyOptions(), proxy.WithHTTPDoer(proxyDoer(b.client)))...)
+	if b.client != old {
+		old.CloseIdleConnections()
+	}
+}
+
+func (b *extraBroker) handler(defaultTokenHandler negroni.HandlerFunc) http.Handler {
+	tokenHandler := defaultTokenHandler
+	if b.tokenRetriever != nil {
+		tokenHandler = token.TokenHandler(b.tokenRetriever, getTokenOptions()...)
+	}
+	return negroni.New(tokenHandler, negroni.HandlerFunc(b.proxy.ServeHTTP))
+}
+
+func getTokenOptions() []token.Option {
+	var opts []token.Option
+
+	switch clientAuthorization := os.Getenv("CLIENT_AUTHORIZATION"); clientAuthorization {
+	case "", "replace":
+	case "reject":
+		opts = append(opts, token.WithClientAuthorization(token.RejectClientAuthorization))
+	case "preserve":
+		opts = append(opts, token.WithClientAuthorization(token.PreserveClientAuthorization))
+	default:
+		log.Fatal(fmt.Sprintf("CLIENT_AUTHORIZATION must be one of replace, reject or preserve: %s", clientAuthorization))
+	}
+
+	return opts
+}
+
+func getServerOptions() []server.Option {
+	var opts []server.Option
+
+	readDrain, mutatingDrain := getDurationEnv("READ_DRAIN_TIMEOUT"), getDurationEnv("MUTATING_DRAIN_TIMEOUT")
+	if readDrain > 0 || mutatingDrain > 0 {
+		if readDrain == 0 {
+			readDrain = server.DefaultReadDrainTimeout
+		}
+		if mutatingDrain == 0 {
+			mutatingDrain = server.DefaultMutatingDrainTimeout
+		}
+		opts = append(opts, server.WithDrainTimeouts(readDrain, mutatingDrain))
+	}
+
+	if maxHeaderBytes := getIntEnv("MAX_HEADER_BYTES"); maxHeaderBytes > 0 {
+		opts = append(opts, server.WithMaxHeaderBytes(int(maxHeaderBytes)))
+	}
+
+	socketOptions := server.SocketOptions{
+		Nagle:       os.Getenv("TCP_NODELAY") == "false",
+		ReadBuffer:  int(getIntEnv("SOCKET_READ_BUFFER_BYTES")),
+		WriteBuffer: int(getIntEnv("SOCKET_WRITE_BUFFER_BYTES")),
+	}
+	if socketOptions != (server.SocketOptions{}) {
+		opts = append(opts, server.WithSocketOptions(socketOptions))
+	}
+
+	if os.Getenv("PROXY_PROTOCOL") == "true" {
+		opts = append(opts, server.WithProxyProtocol(getDurationEnv("PROXY_PROTOCOL_TIMEOUT")))
+	}
+
+	return opts
+}
+
+func getHTTPClientOptions() []httpclient.Option {
+	var opts []httpclient.Option
+
+	keepAlive, keepAliveCount := getDurationEnv("BROKER_KEEPALIVE_INTERVAL"), getIntEnv("BROKER_KEEPALIVE_COUNT")
+	if keepAlive > 0 || keepAliveCount > 0 {
+		if keepAlive == 0 {
+			keepAlive = 30 * time.Second
+		}
+		opts = append(opts, httpclient.WithKeepAlive(keepAlive, keepAlive, int(keepAliveCount)))
+	}
+
+	if localAddr := os.Getenv("BROKER_LOCAL_ADDR"); localAddr != "" {
+		addr, err := httpclient.ParseLocalAddr(localAddr)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("BROKER_LOCAL_ADDR must be a valid IP address: %s", localAddr))
+		}
+		opts = append(opts, httpclient.WithLocalAddr(addr))
+	}
+
+	if dialTimeout := getDurationEnv("BROKER_DIAL_TIMEOUT"); dialTimeout > 0 {
+		opts = append(opts, httpclient.WithDialTimeout(dialTimeout))
+	}
+
+	if handshakeTimeout := getDurationEnv("BROKER_TLS_HANDSHAKE_TIMEOUT"); handshakeTimeout > 0 {
+		opts = append(opts, httpclient.WithTLSHandshakeTimeout(handshakeTimeout))
+	}
+
+	if headerTimeout := getDurationEnv("BROKER_RESPONSE_HEADER_TIMEOUT"); headerTimeout > 0 {
+		opts = append(opts, httpclient.WithResponseHeaderTimeout(headerTimeout))
+	}
+
+	readIdleTimeout, pingTimeout := getDurationEnv("BROKER_HTTP2_READ_IDLE_TIMEOUT"), getDurationEnv("BROKER_HTTP2_PING_TIMEOUT")
+	if readIdleTimeout > 0 || pingTimeout > 0 {
+		if readIdleTimeout == 0 {
+			readIdleTimeout = pingTimeout
+		}
+		opts = append(opts, httpclient.WithHTTP2HealthCheck(readIdleTimeout, pingTimeout))
+	}
+
+	if expectContinueTimeout := getDurationEnv("BROKER_EXPECT_CONTINUE_TIMEOUT"); expectContinueTimeout > 0 {
+		opts = append(opts, httpclient.WithExpectContinueTimeout(expectContinueTimeout))
+	}
+
+	if os.Getenv("BROKER_DISABLE_KEEP_ALIVES") == "true" {
+		opts = append(opts, httpclient.WithDisableKeepAlives())
+	}
+
+	if spkiPins := os.Getenv("BROKER_SPKI_PINS"); spkiPins != "" {
+		var pins [][]byte
+		for _, spkiPin := range strings.Split(spkiPins, ",") {
+			pin, err := httpclient.ParseSPKIPin(spkiPin)
+			if err != nil {
+				log.Fatal(fmt.Sprintf("BROKER_SPKI_PINS must be a comma separated list of base64 SHA-256 pins: %s", err))
+			}
+			pins = append(pins, pin)
+		}
+		opts = append(opts, httpclient.WithSPKIPins(pins...))
+	}
+
+	if stagger := getDurationEnv("BROKER_CONNECTION_STAGGER"); stagger > 0 {
+		opts = append(opts, httpclient.WithConnectionSpreading(stagger, nil))
+	}
+
+	return opts
+}
+
+func getDurationEnv(env string) time.Duration {
+	value := os.Getenv(env)
+	if value == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Fatal(fmt.Sprintf("%s must be a valid duration: %s", env, value))
+	}
+
+	return duration
+}
+
+func getIntEnv(env string) int64 {
+	value := os.Getenv(env)
+	if value == "" {
+		return 0
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 {
+		log.Fatal(fmt.Sprintf("%s must be a positive integer: %s", env, value))
+	}
+
+	return parsed
+}
+
+// logRedacted hands logger a copy of the request whose query has the values
+// of sensitive parameters redacted, while the request itself goes on intact.
+// With attributeBodyBytes set, the OSB attributes of the request are logged
+// too, parsing at most that much of the body as the handlers after read it.
+func logRedacted(logger *negroni.Logger, levels logging.StatusLevels, attributeBodyBytes int64) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		loggedURL := *r.URL
+		loggedURL.RawQuery = redact.Query(loggedURL.RawQuery)
+		logged := r.WithContext(r.Context())
+		logged.URL = &loggedURL
+
+		// A copy per request, to log at the level of its response status.
+		requestLogger := *logger
+		requestLogger.ALogger = logging.StatusLogger(logger.ALogger, levels, w.(negroni.ResponseWriter).Status)
+		if attributeBodyBytes > 0 {
+			attributes := osb.ExtractAttributes(r, attributeBodyBytes)
+			requestLogger.ALogger = logging.WithFields(requestLogger.ALogger, func() string { return attributes().String() })
+		}
+
+		requestLogger.ServeHTTP(w, logged, func(w http.ResponseWriter, _ *http.Request) {
+			next(w, r)
+		})
+	}
+}
+
+// adminRoutes serves the proxy's own endpoints by their exact path and hands
+// every other request to next. Unlike http.ServeMux it never cleans or
+// redirects paths, so requests for the broker are forwarded as they came in.
+type adminRoutes struct {
+	handlers map[string]http.Handler
+	next     http.Handler
+}
+
+func newAdminRoutes(next http.Handler) *adminRoutes {
+	return &adminRoutes{handlers: map[string]http.Handler{}, next: next}
+}
+
+// Handle registers handler for path. It must not be called once serving.
+func (a *adminRoutes) Handle(path string, handler http.Handler) {
+	a.handlers[path] = handler
+}
+
+func (a *adminRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := a.handlers[r.URL.Path]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+// newHealthHandler checks the token source and the broker separately, reusing
+// results for a few seconds. The broker check skips warming connections,
+// which only makes sense at startup.
+func newHealthHandler(tokenFetcher token.TokenRetriever, client proxy.HTTPDoer) http.Handler {
+	brokerChecker := startupchecker.NewChecker(brokerURL, tokenFetcher, client)
+	checks := map[string]health.Check{"broker": brokerChecker.PerformWithContext}
+	if tokenFetcher != nil {
+		checks["token"] = func(ctx context.Context) error {
+			_, err := tokenFetcher.GetToken()
+			return err
+		}
+	}
+	return health.New(checks, 10*time.Second, health.WithCache(5*time.Second))
+}
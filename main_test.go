@@ -153,6 +153,89 @@ var _ = Describe("GCP Broker Proxy", func() {
 				Expect(string(res.Header.Get("Content-Type"))).To(Equal("application/json"))
 			})
 
+			It("reuses the token fetched by the startup checks", func() {
+				Eventually(session).Should(Say("About to listen on port %s", envs.port))
+
+				brokerServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyHeaderKV("Authorization", "Bearer 123"),
+						ghttp.RespondWith(http.StatusOK, "{}"),
+					),
+				)
+
+				res, err := http.DefaultClient.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				res.Body.Close()
+				Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+				Expect(gcpOAuthServer.ReceivedRequests()).To(HaveLen(1))
+			})
+
+			It("forwards paths with dot segments without redirecting", func() {
+				Eventually(session).Should(Say("About to listen on port %s", envs.port))
+
+				brokerServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v2/service_instances/../catalog"),
+						ghttp.RespondWith(http.StatusOK, "{}"),
+					),
+				)
+
+				req, err := http.NewRequest("GET", "http://localhost:"+envs.port+"/v2/service_instances/../catalog", nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.SetBasicAuth(envs.username, envs.password)
+
+				res, err := http.DefaultClient.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				res.Body.Close()
+				Expect(res.StatusCode).To(Equal(http.StatusOK))
+			})
+
+			Context("with repeated slashes in the path", func() {
+				var send = func() int {
+					req, err := http.NewRequest("GET", "http://localhost:"+envs.port+"/v2//catalog", nil)
+					Expect(err).ToNot(HaveOccurred())
+					req.SetBasicAuth(envs.username, envs.password)
+
+					res, err := http.DefaultClient.Do(req)
+					Expect(err).ToNot(HaveOccurred())
+					res.Body.Close()
+					return res.StatusCode
+				}
+
+				It("forwards the path verbatim by default", func() {
+					Eventually(session).Should(Say("About to listen on port %s", envs.port))
+
+					brokerServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", "/v2//catalog"),
+							ghttp.RespondWith(http.StatusOK, "{}"),
+						),
+					)
+
+					Expect(send()).To(Equal(http.StatusOK))
+				})
+
+				Context("when COLLAPSE_SLASHES is enabled", func() {
+					BeforeEach(func() {
+						envs.extra = []string{"COLLAPSE_SLASHES=true"}
+					})
+
+					It("forwards the collapsed path", func() {
+						Eventually(session).Should(Say("About to listen on port %s", envs.port))
+
+						brokerServer.AppendHandlers(
+							ghttp.CombineHandlers(
+								ghttp.VerifyRequest("GET", "/v2/catalog"),
+								ghttp.RespondWith(http.StatusOK, "{}"),
+							),
+						)
+
+						Expect(send()).To(Equal(http.StatusOK))
+					})
+				})
+			})
+
 			It("logs the request and broker response", func() {
 				Eventually(session).Should(Say("About to listen on port " + envs.port))
 
@@ -185,6 +268,51 @@ var _ = Describe("GCP Broker Proxy", func() {
 		})
 	})
 
+	Context("when an admin port is configured", func() {
+		var (
+			adminPort string
+			release   chan struct{}
+		)
+
+		BeforeEach(func() {
+			adminPort = strconv.Itoa(9081 + config.GinkgoConfig.ParallelNode)
+			envs.extra = []string{"ADMIN_PORT=" + adminPort}
+
+			release = make(chan struct{})
+			brokerServer.SetHandler(0, func(w http.ResponseWriter, r *http.Request) {
+				<-release
+				w.Write([]byte("{}"))
+			})
+		})
+
+		AfterEach(func() {
+			select {
+			case <-release:
+			default:
+				close(release)
+			}
+		})
+
+		var readyz = func() int {
+			res, err := http.Get("http://localhost:" + adminPort + "/_proxy/readyz")
+			if err != nil {
+				return -1
+			}
+			res.Body.Close()
+			return res.StatusCode
+		}
+
+		It("serves readiness as not ready during the startup checks and ready after", func() {
+			Eventually(readyz).Should(Equal(http.StatusServiceUnavailable))
+			Consistently(session).ShouldNot(Say("Startup checks passed"))
+
+			close(release)
+
+			Eventually(session).Should(Say("Startup checks passed"))
+			Eventually(readyz).Should(Equal(http.StatusOK))
+		})
+	})
+
 	Describe("when the server is not correctly configured", func() {
 		Context("when the server has not been provided service account information", func() {
 			BeforeEach(func() {
@@ -200,6 +328,23 @@ var _ = Describe("GCP Broker Proxy", func() {
 			})
 		})
 
+		Context("when another configured broker is unreachable", func() {
+			BeforeEach(func() {
+				envs.extra = []string{`API_VERSION_BROKERS={"2.16":{"broker_url":"http://127.0.0.1:1"}}`}
+			})
+
+			It("it fails to start", func() {
+				Eventually(session, 15).Should(gexec.Exit())
+				Expect(session.ExitCode()).NotTo(BeZero())
+			})
+
+			It("logs the broker that failed its startup checks", func() {
+				Eventually(session.Err, 15).Should(Say(`Failed startup checks for http://127.0.0.1:1: `))
+				Eventually(session.Err).Should(Say("Failed startup checks for 1 of 2 brokers"))
+				Expect(session.Out).NotTo(Say("Startup checks passed"))
+			})
+		})
+
 		Context("when the server has not been provided broker url", func() {
 			BeforeEach(func() {
 				envs.brokerURL = ""
@@ -278,6 +423,7 @@ type envVars struct {
 	brokerURL          string
 	username           string
 	password           string
+	extra              []string
 }
 
 func (e *envVars) toStringArray() []string {
@@ -299,5 +445,5 @@ func (e *envVars) toStringArray() []string {
 		result = append(result, "PASSWORD="+e.password)
 	}
 
-	return result
+	return append(result, e.extra...)
 }
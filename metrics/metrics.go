@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// Path is where the metrics are served when they are enabled.
+const Path = "/_proxy/metrics"
+
+// Labels identify a series of requests. Operation is the OSB operation the
+// path and method map to, so that, for example, provisions can be told apart
+// from catalog fetches regardless of instance ID.
+type Labels struct {
+	Operation osb.Operation `json:"operation"`
+	Method    string        `json:"method"`
+	Status    int           `json:"status"`
+}
+
+// LabelsFor classifies r and the status it was answered with.
+func LabelsFor(r *http.Request, status int) Labels {
+	return Labels{
+		Operation: osb.Parse(r.Method, r.URL.Path).Operation,
+		Method:    r.Method,
+		Status:    status,
+	}
+}
+
+// Series is the count and latency of the requests sharing Labels.
+type Series struct {
+	Labels
+	Count        uint64  `json:"count"`
+	TotalSeconds float64 `json:"total_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+}
+
+// Requests records the requests passing through its middleware, by Labels.
+type Requests struct {
+	mu     sync.Mutex
+	series map[Labels]*Series
+}
+
+func New() *Requests {
+	return &Requests{series: map[Labels]*Series{}}
+}
+
+func (m *Requests) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		rw, ok := w.(negroni.ResponseWriter)
+		if !ok {
+			rw = negroni.NewResponseWriter(w)
+		}
+
+		start := time.Now()
+		next(rw, r)
+
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.Observe(LabelsFor(r, status), time.Since(start))
+	})
+}
+
+// Observe adds a request taking d to the series of labels.
+func (m *Requests) Observe(labels Labels, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[labels]
+	if !ok {
+		s = &Series{Labels: labels}
+		m.series[labels] = s
+	}
+
+	seconds := d.Seconds()
+	s.Count++
+	s.TotalSeconds += seconds
+	if seconds > s.MaxSeconds {
+		s.MaxSeconds = seconds
+	}
+}
+
+// Series returns every series recorded so far, ordered by operation, method
+// and status.
+func (m *Requests) Series() []Series {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := make([]Series, 0, len(m.series))
+	for _, s := range m.series {
+		series = append(series, *s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		a, b := series[i], series[j]
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.Status < b.Status
+	})
+	return series
+}
+
+// ServeHTTP serves every series as a JSON array.
+func (m *Requests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Series())
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/metrics"
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Requests", func() {
+	DescribeTable("labels requests by operation",
+		func(method, path string, operation osb.Operation) {
+			labels := metrics.LabelsFor(httptest.NewRequest(method, path, nil), http.StatusOK)
+			Expect(labels).To(Equal(metrics.Labels{Operation: operation, Method: method, Status: http.StatusOK}))
+		},
+		Entry("catalog", "GET", "/v2/catalog", osb.Catalog),
+		Entry("provision", "PUT", "/v2/service_instances/6f1c2a", osb.Provision),
+		Entry("deprovision", "DELETE", "/v2/service_instances/6f1c2a?service_id=s&plan_id=p", osb.Deprovision),
+		Entry("bind", "PUT", "/v2/service_instances/6f1c2a/service_bindings/b7e2", osb.Bind),
+		Entry("unbind", "DELETE", "/v2/service_instances/6f1c2a/service_bindings/b7e2", osb.Unbind),
+		Entry("last operation", "GET", "/v2/service_instances/6f1c2a/last_operation", osb.LastOperation),
+		Entry("binding last operation", "GET", "/v2/service_instances/6f1c2a/service_bindings/b7e2/last_operation", osb.BindingLastOperation),
+		Entry("unknown", "GET", "/v2/something-else", osb.Unknown),
+	)
+
+	It("records the count and latency of each series", func() {
+		requests := metrics.New()
+
+		n := negroni.New(requests.Middleware())
+		n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				w.WriteHeader(http.StatusCreated)
+			}
+		})
+
+		for _, r := range []*http.Request{
+			httptest.NewRequest("GET", "/v2/catalog", nil),
+			httptest.NewRequest("PUT", "/v2/service_instances/a", nil),
+			httptest.NewRequest("PUT", "/v2/service_instances/b", nil),
+		} {
+			n.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		series := requests.Series()
+		Expect(series).To(HaveLen(2))
+		Expect(series[0].Labels).To(Equal(metrics.Labels{Operation: osb.Catalog, Method: "GET", Status: http.StatusOK}))
+		Expect(series[0].Count).To(BeEquivalentTo(1))
+		Expect(series[1].Labels).To(Equal(metrics.Labels{Operation: osb.Provision, Method: "PUT", Status: http.StatusCreated}))
+		Expect(series[1].Count).To(BeEquivalentTo(2))
+	})
+
+	It("tracks total and maximum latency", func() {
+		requests := metrics.New()
+		labels := metrics.Labels{Operation: osb.Provision, Method: "PUT", Status: http.StatusAccepted}
+
+		requests.Observe(labels, time.Second)
+		requests.Observe(labels, 3*time.Second)
+
+		Expect(requests.Series()).To(ConsistOf(metrics.Series{
+			Labels:       labels,
+			Count:        2,
+			TotalSeconds: 4,
+			MaxSeconds:   3,
+		}))
+	})
+
+	It("serves the series as JSON", func() {
+		requests := metrics.New()
+		requests.Observe(metrics.Labels{Operation: osb.Catalog, Method: "GET", Status: http.StatusOK}, time.Second)
+
+		w := httptest.NewRecorder()
+		requests.ServeHTTP(w, httptest.NewRequest("GET", metrics.Path, nil))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(w.Body.String()).To(MatchJSON(`[{"operation":"catalog","method":"GET","status":200,"count":1,"total_seconds":1,"max_seconds":1}]`))
+	})
+
+	It("is read-only", func() {
+		w := httptest.NewRecorder()
+		metrics.New().ServeHTTP(w, httptest.NewRequest("POST", metrics.Path, nil))
+
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
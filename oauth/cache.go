@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/clock"
+)
+
+// expiryDelta refreshes tokens slightly before they expire, like oauth2 does,
+// so a token is not sent moments before the broker would reject it.
+const expiryDelta = 10 * time.Second
+
+type Option func(*tokenCache)
+
+// WithClock makes the token cache read the time from c, so tests control
+// when tokens expire.
+func WithClock(c clock.Clock) Option {
+	return func(t *tokenCache) {
+		t.clock = c
+	}
+}
+
+// WithMinTTL refreshes cached tokens once less than ttl of their lifetime
+// remains, so a token handed to the broker stays valid through long running
+// operations. It should be well below the lifetime of the tokens, which is an
+// hour for Google, or every request fetches a new one.
+func WithMinTTL(ttl time.Duration) Option {
+	return func(t *tokenCache) {
+		if ttl > t.minTTL {
+			t.minTTL = ttl
+		}
+	}
+}
+
+// tokenCache reuses the token returned by fetch until, by its clock, less
+// than minTTL of it remains. Tokens without an expiry are kept for good.
+type tokenCache struct {
+	fetch  func() (*oauth2.Token, error)
+	clock  clock.Clock
+	minTTL time.Duration
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func newTokenCache(fetch func() (*oauth2.Token, error), opts []Option) *tokenCache {
+	cache := &tokenCache{fetch: fetch, clock: clock.Real, minTTL: expiryDelta}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	return cache
+}
+
+func (c *tokenCache) get() (*oauth2.Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid(c.token) {
+		return c.token, nil
+	}
+
+	token, err := c.fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
+}
+
+func (c *tokenCache) valid(token *oauth2.Token) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry.IsZero() || c.clock.Now().Before(token.Expiry.Add(-c.minTTL))
+}
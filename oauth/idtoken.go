@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jws"
+	"golang.org/x/oauth2/jwt"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/clock"
+)
+
+const (
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// tokenRequestTimeout bounds a token request, as the token cache holds
+	// its lock and every caller waits while one is in flight.
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// GCPIDToken retrieves Google-signed ID tokens for a fixed audience, as
+// required by brokers sitting behind Identity-Aware Proxy. The ID token is
+// returned in the AccessToken field so it can be used wherever a
+// TokenRetriever is expected.
+type GCPIDToken struct {
+	audience string
+	tokens   *tokenCache
+}
+
+func NewGCPIDToken(serviceAccountJSON, audience string, opts ...Option) (*GCPIDToken, error) {
+	if audience == "" {
+		return nil, errors.New("Missing audience for ID token")
+	}
+
+	tokens, err := NewGCPIDTokens(serviceAccountJSON, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens.ForAudience(audience), nil
+}
+
+func (o *GCPIDToken) GetToken() (*oauth2.Token, error) {
+	token, err := o.tokens.get()
+	if err != nil {
+		return nil, err
+	}
+
+	if token.AccessToken == "" {
+		return nil, errors.New("Missing id_token in oauth response")
+	}
+
+	return token, nil
+}
+
+// GCPIDTokens retrieves ID tokens for any number of audiences with one
+// service account, e.g. for several brokers behind different IAP clients.
+// Each audience has its own cached token, refreshed on its own schedule.
+type GCPIDTokens struct {
+	conf   *jwt.Config
+	key    *rsa.PrivateKey
+	client *http.Client
+	opts   []Option
+
+	mu     sync.Mutex
+	caches map[string]*tokenCache
+}
+
+func NewGCPIDTokens(serviceAccountJSON string, opts ...Option) (*GCPIDTokens, error) {
+	conf, err := google.JWTConfigFromJSON([]byte(serviceAccountJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	// The key is parsed once here rather than for every token, so a bad
+	// key fails at startup.
+	key, err := parseKey(conf.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCPIDTokens{
+		conf:   conf,
+		key:    key,
+		client: &http.Client{Timeout: tokenRequestTimeout},
+		opts:   opts,
+		caches: map[string]*tokenCache{},
+	}, nil
+}
+
+// ForAudience returns a GCPIDToken for audience sharing the cached token of
+// every other GCPIDToken returned for it.
+func (t *GCPIDTokens) ForAudience(audience string) *GCPIDToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cache, ok := t.caches[audience]
+	if !ok {
+		cache = newTokenCache(nil, t.opts)
+		source := idTokenSource{conf: t.conf, key: t.key, client: t.client, clock: cache.clock, audience: audience}
+		cache.fetch = source.Token
+		t.caches[audience] = cache
+	}
+
+	return &GCPIDToken{audience: audience, tokens: cache}
+}
+
+// idTokenSource exchanges a self-signed JWT carrying a target_audience claim
+// for a Google-signed ID token.
+type idTokenSource struct {
+	conf     *jwt.Config
+	key      *rsa.PrivateKey
+	client   *http.Client
+	clock    clock.Clock
+	audience string
+}
+
+func (s idTokenSource) Token() (*oauth2.Token, error) {
+	now := s.clock.Now()
+	claimSet := &jws.ClaimSet{
+		Iss:           s.conf.Email,
+		Aud:           s.conf.TokenURL,
+		Iat:           now.Unix(),
+		Exp:           now.Add(time.Hour).Unix(),
+		PrivateClaims: map[string]interface{}{"target_audience": s.audience},
+	}
+	header := &jws.Header{Algorithm: "RS256", Typ: "JWT", KeyID: s.conf.PrivateKeyID}
+
+	assertion, err := jws.Encode(header, claimSet, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", jwtBearerGrantType)
+	form.Set("assertion", assertion)
+
+	res, err := s.client.PostForm(s.conf.TokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: cannot fetch token: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: cannot fetch token: %v", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, &oauth2.RetrieveError{Response: res, Body: body}
+	}
+
+	var tokenRes struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenRes); err != nil {
+		return nil, fmt.Errorf("oauth2: cannot fetch token: %v", err)
+	}
+
+	token := &oauth2.Token{AccessToken: tokenRes.IDToken, TokenType: "Bearer"}
+	if tokenRes.IDToken != "" {
+		idClaims, err := jws.Decode(tokenRes.IDToken)
+		if err != nil {
+			return nil, fmt.Errorf("oauth2: error decoding ID token: %v", err)
+		}
+		token.Expiry = time.Unix(idClaims.Exp, 0)
+	}
+
+	return token, nil
+}
+
+// parseKey mirrors the parser of oauth2, which is internal to it.
+func parseKey(key []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block != nil {
+		key = block.Bytes
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		parsedKey, err = x509.ParsePKCS1PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("private key should be a PEM or plain PKCS1 or PKCS8; parse error: %v", err)
+		}
+	}
+
+	parsed, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is invalid")
+	}
+
+	return parsed, nil
+}
@@ -14,11 +14,11 @@ var (
 )
 
 type GCPOAuth struct {
-	jwt   *jwt.Config
-	token *oauth2.Token
+	jwt    *jwt.Config
+	tokens *tokenCache
 }
 
-func NewGCPOAuth(serviceAccountJSON string) (*GCPOAuth, error) {
+func NewGCPOAuth(serviceAccountJSON string, opts ...Option) (*GCPOAuth, error) {
 	rawJSON := []byte(serviceAccountJSON)
 
 	jwt, err := google.JWTConfigFromJSON(rawJSON, scopes)
@@ -26,24 +26,25 @@ func NewGCPOAuth(serviceAccountJSON string) (*GCPOAuth, error) {
 		return nil, err
 	}
 
-	oauth := GCPOAuth{jwt, nil}
+	oauth := GCPOAuth{jwt: jwt}
+	// A fresh token source every time, as the one of jwt.Config reuses its
+	// token by the wall clock rather than the clock of the cache.
+	oauth.tokens = newTokenCache(func() (*oauth2.Token, error) {
+		return jwt.TokenSource(context.Background()).Token()
+	}, opts)
 
 	return &oauth, nil
 }
 
 func (o *GCPOAuth) GetToken() (*oauth2.Token, error) {
-	tokenSource := oauth2.ReuseTokenSource(o.token, o.jwt.TokenSource(context.Background()))
-
-	var err error
-	o.token, err = tokenSource.Token()
-
+	token, err := o.tokens.get()
 	if err != nil {
-		return o.token, err
+		return nil, err
 	}
 
-	if o.token.AccessToken == "" {
+	if token.AccessToken == "" {
 		return nil, errors.New("Missing access_token in oauth response")
 	}
 
-	return o.token, err
+	return token, nil
 }
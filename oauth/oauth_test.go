@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -33,8 +34,15 @@ var _ = Describe("GCPOAuth", func() {
 			oauth                   *GCPOAuth
 			gcpOAuthServer          *httptest.Server
 			responseFromOAuthServer string
+			clock                   *fakeClock
+			opts                    []Option
 		)
 
+		BeforeEach(func() {
+			clock = &fakeClock{now: time.Now()}
+			opts = []Option{WithClock(clock)}
+		})
+
 		JustBeforeEach(func() {
 			gcpOAuthServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				fmt.Fprint(w, responseFromOAuthServer)
@@ -55,7 +63,7 @@ var _ = Describe("GCPOAuth", func() {
 				"client_x509_cert_url": "https://www.googleapis.com/robot/v1/metadata/x509/oauth-testing%40oauth-test-172301.iam.gserviceaccount.com"
 			}`
 			var err error
-			oauth, err = NewGCPOAuth(serviceAccountJSON)
+			oauth, err = NewGCPOAuth(serviceAccountJSON, opts...)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -85,6 +93,69 @@ var _ = Describe("GCPOAuth", func() {
 			})
 		})
 
+		Context("When the access token expires", func() {
+			BeforeEach(func() {
+				responseFromOAuthServer = `{"access_token": "123", "expires_in": 3600}`
+			})
+
+			It("reuses it until shortly before it expires and then fetches a new one", func() {
+				token, err := oauth.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(token.AccessToken).To(Equal("123"))
+
+				responseFromOAuthServer = `{"access_token": "456", "expires_in": 3600}`
+
+				clock.now = clock.now.Add(59 * time.Minute)
+				token, _ = oauth.GetToken()
+				Expect(token.AccessToken).To(Equal("123"))
+
+				clock.now = clock.now.Add(55 * time.Second)
+				token, err = oauth.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(token.AccessToken).To(Equal("456"))
+			})
+		})
+
+		Context("When a minimum TTL is configured", func() {
+			BeforeEach(func() {
+				opts = append(opts, WithMinTTL(5*time.Minute))
+				responseFromOAuthServer = `{"access_token": "123", "expires_in": 3600}`
+			})
+
+			It("refreshes the token before less than the minimum TTL remains", func() {
+				token, err := oauth.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(token.AccessToken).To(Equal("123"))
+
+				responseFromOAuthServer = `{"access_token": "456", "expires_in": 3600}`
+
+				clock.now = clock.now.Add(54 * time.Minute)
+				token, _ = oauth.GetToken()
+				Expect(token.AccessToken).To(Equal("123"))
+
+				clock.now = clock.now.Add(90 * time.Second)
+				token, err = oauth.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(token.AccessToken).To(Equal("456"))
+			})
+
+			Context("when it is shorter than the expiry delta", func() {
+				BeforeEach(func() {
+					opts = []Option{WithClock(clock), WithMinTTL(time.Second)}
+				})
+
+				It("still refreshes shortly before expiry", func() {
+					oauth.GetToken()
+					responseFromOAuthServer = `{"access_token": "456", "expires_in": 3600}`
+
+					clock.now = clock.now.Add(59*time.Minute + 55*time.Second)
+					token, err := oauth.GetToken()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(token.AccessToken).To(Equal("456"))
+				})
+			})
+		})
+
 		Context("When unable to get a token", func() {
 			BeforeEach(func() {
 				responseFromOAuthServer = `invalid-response`
@@ -108,3 +179,12 @@ var _ = Describe("GCPOAuth", func() {
 		})
 	})
 })
+
+// fakeClock tells whatever time the test sets.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,122 @@
+package osb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxAttributeBodyBytes covers the bodies of all but the largest
+// provision and bind requests.
+const DefaultMaxAttributeBodyBytes = 64 << 10
+
+// Attributes are the OSB fields of a request worth searching logs by.
+type Attributes struct {
+	Operation  Operation
+	InstanceID string
+	BindingID  string
+	ServiceID  string
+	PlanID     string
+	Platform   string
+}
+
+// ExtractAttributes reads the attributes of r from its path, its query and its
+// originating identity. For PUT and PATCH it also keeps a copy of up to
+// maxBodyBytes of the body as the handlers after r read it, never reading the
+// body itself. The returned function gives the attributes, with the service
+// and plan ids of the body once the handlers have read all of it. Larger
+// bodies are not parsed.
+func ExtractAttributes(r *http.Request, maxBodyBytes int64) func() Attributes {
+	route := Parse(r.Method, r.URL.Path)
+	attributes := Attributes{
+		Operation:  route.Operation,
+		InstanceID: route.InstanceID,
+		BindingID:  route.BindingID,
+		ServiceID:  r.URL.Query().Get("service_id"),
+		PlanID:     r.URL.Query().Get("plan_id"),
+	}
+
+	if identity, ok := ParseOriginatingIdentity(r); ok {
+		attributes.Platform = identity.Platform
+	}
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch || r.Body == nil || r.Body == http.NoBody || maxBodyBytes <= 0 {
+		return func() Attributes { return attributes }
+	}
+
+	head := &bodyHead{ReadCloser: r.Body, max: maxBodyBytes}
+	r.Body = head
+	return func() Attributes {
+		var body struct {
+			ServiceID string `json:"service_id"`
+			PlanID    string `json:"plan_id"`
+		}
+		if read, ok := head.bytes(); ok && json.Unmarshal(read, &body) == nil {
+			if body.ServiceID != "" {
+				attributes.ServiceID = body.ServiceID
+			}
+			if body.PlanID != "" {
+				attributes.PlanID = body.PlanID
+			}
+		}
+		return attributes
+	}
+}
+
+// bodyHead copies the first max bytes read through it.
+type bodyHead struct {
+	io.ReadCloser
+	max int64
+
+	mu   sync.Mutex
+	head []byte
+	over bool
+}
+
+func (b *bodyHead) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.over:
+	case int64(len(b.head)+n) > b.max:
+		b.over = true
+	default:
+		b.head = append(b.head, p[:n]...)
+	}
+	return n, err
+}
+
+// bytes returns what was read so far, unless that was more than max.
+func (b *bodyHead) bytes() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.head, !b.over
+}
+
+// String formats the attributes that are set as key=value pairs, quoting
+// values that would otherwise be ambiguous.
+func (a Attributes) String() string {
+	var fields []string
+	for _, field := range []struct{ key, value string }{
+		{"operation", string(a.Operation)},
+		{"instance_id", a.InstanceID},
+		{"binding_id", a.BindingID},
+		{"service_id", a.ServiceID},
+		{"plan_id", a.PlanID},
+		{"platform", a.Platform},
+	} {
+		switch {
+		case field.value == "":
+		case strings.ContainsAny(field.value, " \"=\r\n\t"):
+			fields = append(fields, fmt.Sprintf("%s=%q", field.key, field.value))
+		default:
+			fields = append(fields, fmt.Sprintf("%s=%s", field.key, field.value))
+		}
+	}
+	return strings.Join(fields, " ")
+}
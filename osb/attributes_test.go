@@ -0,0 +1,89 @@
+package osb_test
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractAttributes", func() {
+	var identity = "cloudfoundry " + base64.StdEncoding.EncodeToString([]byte(`{"user_id":"683ea748"}`))
+
+	It("extracts the attributes of a provision from its path and body", func() {
+		body := `{"service_id":"sql","plan_id":"small","parameters":{"tier":"db-f1"}}`
+		req := httptest.NewRequest("PUT", "/v2/service_instances/inst-1?accepts_incomplete=true", strings.NewReader(body))
+		req.Header.Set(osb.OriginatingIdentityHeader, identity)
+
+		attributes := osb.ExtractAttributes(req, osb.DefaultMaxAttributeBodyBytes)
+		forwarded, _ := ioutil.ReadAll(req.Body)
+		Expect(string(forwarded)).To(Equal(body))
+
+		Expect(attributes()).To(Equal(osb.Attributes{
+			Operation:  osb.Provision,
+			InstanceID: "inst-1",
+			ServiceID:  "sql",
+			PlanID:     "small",
+			Platform:   "cloudfoundry",
+		}))
+		Expect(attributes().String()).To(Equal("operation=provision instance_id=inst-1 service_id=sql plan_id=small platform=cloudfoundry"))
+	})
+
+	It("does not read the body itself", func() {
+		body := &slowBody{Reader: strings.NewReader(`{"service_id":"sql","plan_id":"small"}`)}
+		req := httptest.NewRequest("PUT", "/v2/service_instances/inst-1", body)
+
+		attributes := osb.ExtractAttributes(req, osb.DefaultMaxAttributeBodyBytes)
+
+		Expect(body.reads).To(BeZero())
+		Expect(attributes()).To(Equal(osb.Attributes{Operation: osb.Provision, InstanceID: "inst-1"}))
+	})
+
+	It("extracts the attributes of a last_operation poll from its path and query", func() {
+		req := httptest.NewRequest("GET", "/v2/service_instances/inst-1/service_bindings/bind-1/last_operation?service_id=sql&plan_id=small&operation=op", nil)
+
+		attributes := osb.ExtractAttributes(req, osb.DefaultMaxAttributeBodyBytes)
+
+		Expect(attributes()).To(Equal(osb.Attributes{
+			Operation:  osb.BindingLastOperation,
+			InstanceID: "inst-1",
+			BindingID:  "bind-1",
+			ServiceID:  "sql",
+			PlanID:     "small",
+		}))
+	})
+
+	It("does not parse bodies larger than the limit but forwards them in full", func() {
+		body := `{"service_id":"sql","plan_id":"small","parameters":{"blob":"` + strings.Repeat("x", 100) + `"}}`
+		req := httptest.NewRequest("PATCH", "/v2/service_instances/inst-1", strings.NewReader(body))
+
+		attributes := osb.ExtractAttributes(req, 64)
+		forwarded, _ := ioutil.ReadAll(req.Body)
+		Expect(string(forwarded)).To(Equal(body))
+
+		Expect(attributes().ServiceID).To(BeEmpty())
+		Expect(attributes().PlanID).To(BeEmpty())
+	})
+
+	It("quotes values that would make the fields ambiguous", func() {
+		attributes := osb.Attributes{Operation: osb.Bind, ServiceID: "my service"}
+		Expect(attributes.String()).To(Equal(`operation=bind service_id="my service"`))
+	})
+})
+
+// slowBody counts the reads made of it.
+type slowBody struct {
+	io.Reader
+	reads int
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	b.reads++
+	return b.Reader.Read(p)
+}
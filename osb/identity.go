@@ -0,0 +1,70 @@
+package osb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const OriginatingIdentityHeader = "X-Broker-API-Originating-Identity"
+
+// OriginatingIdentity is the decoded X-Broker-API-Originating-Identity header,
+// e.g. platform "cloudfoundry" with value {"user_id": "..."}.
+type OriginatingIdentity struct {
+	Platform string                 `json:"platform"`
+	Value    map[string]interface{} `json:"value"`
+}
+
+// ParseOriginatingIdentity decodes the originating identity of r. It returns
+// false when the header is absent or malformed.
+func ParseOriginatingIdentity(r *http.Request) (OriginatingIdentity, bool) {
+	identity, err := DecodeOriginatingIdentity(r.Header.Get(OriginatingIdentityHeader))
+	return identity, err == nil
+}
+
+func DecodeOriginatingIdentity(header string) (OriginatingIdentity, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return OriginatingIdentity{}, errors.New("Originating identity must be a platform and a value")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return OriginatingIdentity{}, err
+	}
+
+	identity := OriginatingIdentity{Platform: parts[0]}
+	if err := json.Unmarshal(raw, &identity.Value); err != nil {
+		return OriginatingIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+// Encode formats the identity as the value of the
+// X-Broker-API-Originating-Identity header.
+func (i OriginatingIdentity) Encode() (string, error) {
+	value := i.Value
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return i.Platform + " " + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// User returns the platform user of the identity, which Cloud Foundry sends as
+// user_id and Kubernetes as username.
+func (i OriginatingIdentity) User() string {
+	for _, key := range []string{"user_id", "username"} {
+		if user, ok := i.Value[key].(string); ok && user != "" {
+			return user
+		}
+	}
+	return ""
+}
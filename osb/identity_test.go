@@ -0,0 +1,63 @@
+package osb_test
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OriginatingIdentity", func() {
+	var encode = func(platform, value string) string {
+		return platform + " " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	It("decodes the platform and value", func() {
+		identity, err := osb.DecodeOriginatingIdentity(encode("cloudfoundry", `{"user_id": "683ea748"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity.Platform).To(Equal("cloudfoundry"))
+		Expect(identity.Value).To(Equal(map[string]interface{}{"user_id": "683ea748"}))
+		Expect(identity.User()).To(Equal("683ea748"))
+	})
+
+	It("finds the user of kubernetes identities", func() {
+		identity, err := osb.DecodeOriginatingIdentity(encode("kubernetes", `{"username": "duke", "uid": "c2dde242"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity.User()).To(Equal("duke"))
+	})
+
+	It("rejects malformed identities", func() {
+		_, err := osb.DecodeOriginatingIdentity("cloudfoundry")
+		Expect(err).To(HaveOccurred())
+
+		_, err = osb.DecodeOriginatingIdentity("cloudfoundry not-base64!")
+		Expect(err).To(HaveOccurred())
+
+		_, err = osb.DecodeOriginatingIdentity(encode("cloudfoundry", "not json"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses the identity header of a request", func() {
+		req, _ := http.NewRequest("GET", "/v2/catalog", nil)
+		_, ok := osb.ParseOriginatingIdentity(req)
+		Expect(ok).To(BeFalse())
+
+		req.Header.Set("X-Broker-API-Originating-Identity", encode("cloudfoundry", `{"user_id": "683ea748"}`))
+		identity, ok := osb.ParseOriginatingIdentity(req)
+		Expect(ok).To(BeTrue())
+		Expect(identity.User()).To(Equal("683ea748"))
+	})
+
+	It("encodes an identity the way it decodes it", func() {
+		header, err := osb.OriginatingIdentity{Platform: "kubernetes", Value: map[string]interface{}{"username": "admin"}}.Encode()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal(encode("kubernetes", `{"username":"admin"}`)))
+
+		identity, err := osb.DecodeOriginatingIdentity(header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity.User()).To(Equal("admin"))
+	})
+})
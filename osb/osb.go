@@ -0,0 +1,94 @@
+package osb
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIVersionHeader carries the OSB API version a platform speaks.
+const APIVersionHeader = "X-Broker-API-Version"
+
+type Operation string
+
+const (
+	Catalog              Operation = "catalog"
+	Provision            Operation = "provision"
+	Update               Operation = "update"
+	Deprovision          Operation = "deprovision"
+	GetInstance          Operation = "get_instance"
+	LastOperation        Operation = "last_operation"
+	Bind                 Operation = "bind"
+	Unbind               Operation = "unbind"
+	GetBinding           Operation = "get_binding"
+	BindingLastOperation Operation = "binding_last_operation"
+	Unknown              Operation = "unknown"
+)
+
+// Route describes which Open Service Broker endpoint a request targets.
+type Route struct {
+	Operation  Operation
+	InstanceID string
+	BindingID  string
+}
+
+// Parse classifies a request to the broker by its method and path.
+func Parse(method, path string) Route {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(segments) == 2 && segments[0] == "v2" && segments[1] == "catalog" {
+		if method == http.MethodGet {
+			return Route{Operation: Catalog}
+		}
+		return Route{Operation: Unknown}
+	}
+
+	if len(segments) < 3 || segments[0] != "v2" || segments[1] != "service_instances" || segments[2] == "" {
+		return Route{Operation: Unknown}
+	}
+
+	route := Route{Operation: Unknown, InstanceID: segments[2]}
+	rest := segments[3:]
+
+	switch {
+	case len(rest) == 0:
+		route.Operation = instanceOperations[method]
+	case len(rest) == 1 && rest[0] == "last_operation" && method == http.MethodGet:
+		route.Operation = LastOperation
+	case len(rest) >= 2 && rest[0] == "service_bindings" && rest[1] != "":
+		route.BindingID = rest[1]
+		switch {
+		case len(rest) == 2:
+			route.Operation = bindingOperations[method]
+		case len(rest) == 3 && rest[2] == "last_operation" && method == http.MethodGet:
+			route.Operation = BindingLastOperation
+		}
+	}
+
+	if route.Operation == "" {
+		route.Operation = Unknown
+	}
+
+	return route
+}
+
+// IsMutating reports whether the operation changes broker state.
+func (o Operation) IsMutating() bool {
+	switch o {
+	case Provision, Update, Deprovision, Bind, Unbind:
+		return true
+	}
+	return false
+}
+
+var instanceOperations = map[string]Operation{
+	http.MethodPut:    Provision,
+	http.MethodPatch:  Update,
+	http.MethodDelete: Deprovision,
+	http.MethodGet:    GetInstance,
+}
+
+var bindingOperations = map[string]Operation{
+	http.MethodPut:    Bind,
+	http.MethodDelete: Unbind,
+	http.MethodGet:    GetBinding,
+}
@@ -0,0 +1,46 @@
+package osb_test
+
+import (
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	DescribeTable("classifies OSB endpoints",
+		func(method, path string, expected osb.Route) {
+			Expect(osb.Parse(method, path)).To(Equal(expected))
+		},
+		Entry("catalog", "GET", "/v2/catalog", osb.Route{Operation: osb.Catalog}),
+		Entry("provision", "PUT", "/v2/service_instances/inst-1", osb.Route{Operation: osb.Provision, InstanceID: "inst-1"}),
+		Entry("update", "PATCH", "/v2/service_instances/inst-1", osb.Route{Operation: osb.Update, InstanceID: "inst-1"}),
+		Entry("deprovision", "DELETE", "/v2/service_instances/inst-1", osb.Route{Operation: osb.Deprovision, InstanceID: "inst-1"}),
+		Entry("get instance", "GET", "/v2/service_instances/inst-1", osb.Route{Operation: osb.GetInstance, InstanceID: "inst-1"}),
+		Entry("last operation", "GET", "/v2/service_instances/inst-1/last_operation", osb.Route{Operation: osb.LastOperation, InstanceID: "inst-1"}),
+		Entry("bind", "PUT", "/v2/service_instances/inst-1/service_bindings/bind-1", osb.Route{Operation: osb.Bind, InstanceID: "inst-1", BindingID: "bind-1"}),
+		Entry("unbind", "DELETE", "/v2/service_instances/inst-1/service_bindings/bind-1", osb.Route{Operation: osb.Unbind, InstanceID: "inst-1", BindingID: "bind-1"}),
+		Entry("get binding", "GET", "/v2/service_instances/inst-1/service_bindings/bind-1", osb.Route{Operation: osb.GetBinding, InstanceID: "inst-1", BindingID: "bind-1"}),
+		Entry("binding last operation", "GET", "/v2/service_instances/inst-1/service_bindings/bind-1/last_operation", osb.Route{Operation: osb.BindingLastOperation, InstanceID: "inst-1", BindingID: "bind-1"}),
+		Entry("trailing slash", "GET", "/v2/catalog/", osb.Route{Operation: osb.Catalog}),
+		Entry("unsupported method", "POST", "/v2/service_instances/inst-1", osb.Route{Operation: osb.Unknown, InstanceID: "inst-1"}),
+		Entry("missing instance id", "PUT", "/v2/service_instances/", osb.Route{Operation: osb.Unknown}),
+		Entry("unknown path", "GET", "/v2/something-else", osb.Route{Operation: osb.Unknown}),
+		Entry("root", "GET", "/", osb.Route{Operation: osb.Unknown}),
+	)
+
+	Describe("IsMutating", func() {
+		It("is true for operations that change broker state", func() {
+			for _, op := range []osb.Operation{osb.Provision, osb.Update, osb.Deprovision, osb.Bind, osb.Unbind} {
+				Expect(op.IsMutating()).To(BeTrue(), string(op))
+			}
+		})
+
+		It("is false for reads", func() {
+			for _, op := range []osb.Operation{osb.Catalog, osb.GetInstance, osb.LastOperation, osb.GetBinding, osb.BindingLastOperation, osb.Unknown} {
+				Expect(op.IsMutating()).To(BeFalse(), string(op))
+			}
+		})
+	})
+})
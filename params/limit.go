@@ -0,0 +1,99 @@
+package params
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// maxOtherFieldsBytes is how much room Limit leaves in a body for the fields
+// besides its parameters.
+const maxOtherFieldsBytes = 64 << 10
+
+// Limit rejects provision and update requests whose parameters object is
+// larger than maxBytes or nested deeper than maxDepth with a 400. A limit of
+// zero is not enforced. The body is read no further than it can be valid:
+// past maxBytes plus room for the other fields, or past MaxBodyBytes without
+// maxBytes, the request gets a 413. Otherwise it is forwarded unchanged.
+func Limit(maxBytes, maxDepth int) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		operation := osb.Parse(r.Method, r.URL.Path).Operation
+		if (operation != osb.Provision && operation != osb.Update) || r.Body == nil {
+			next(w, r)
+			return
+		}
+
+		maxBody := int64(MaxBodyBytes)
+		if maxBytes > 0 {
+			maxBody = int64(maxBytes) + maxOtherFieldsBytes
+		}
+
+		raw, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		r.Body.Close()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Error reading request body"))
+			return
+		}
+		if int64(len(raw)) > maxBody {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(fmt.Sprintf("Request body exceeds %d bytes", maxBody)))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+		var body struct {
+			Parameters json.RawMessage `json:"parameters"`
+		}
+		if len(bytes.TrimSpace(raw)) == 0 || json.Unmarshal(raw, &body) != nil {
+			// Malformed bodies are left for the broker to reject.
+			next(w, r)
+			return
+		}
+
+		if maxBytes > 0 && len(body.Parameters) > maxBytes {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Parameters exceed %d bytes", maxBytes)))
+			return
+		}
+
+		if maxDepth > 0 && depth(body.Parameters) > maxDepth {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Parameters nested deeper than %d levels", maxDepth)))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// depth returns how deeply objects and arrays nest in raw. The parameters
+// object itself is one level.
+func depth(raw json.RawMessage) int {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+
+	current, deepest := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return deepest
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			current++
+			if current > deepest {
+				deepest = current
+			}
+		case json.Delim('}'), json.Delim(']'):
+			current--
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package params_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/params"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limit", func() {
+	var (
+		forwardBody string
+		called      bool
+		writer      *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		forwardBody = ""
+		called = false
+		writer = httptest.NewRecorder()
+	})
+
+	var send = func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+
+		params.Limit(64, 3)(writer, req, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			b, _ := ioutil.ReadAll(r.Body)
+			forwardBody = string(b)
+		})
+	}
+
+	It("forwards acceptable parameters unchanged", func() {
+		body := `{"service_id":"s", "parameters":{"labels":{"team":["a"]}}}`
+		send("PUT", "/v2/service_instances/123", body)
+
+		Expect(called).To(BeTrue())
+		Expect(forwardBody).To(Equal(body))
+	})
+
+	It("rejects parameters larger than the limit", func() {
+		send("PUT", "/v2/service_instances/123", `{"parameters":{"blob":"`+strings.Repeat("x", 64)+`"}}`)
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		Expect(writer.Body.String()).To(Equal("Parameters exceed 64 bytes"))
+	})
+
+	It("stops reading bodies too large to be within the limit", func() {
+		body := io.MultiReader(strings.NewReader(`{"parameters":{"blob":"`), endless('x'))
+		req := httptest.NewRequest("PUT", "/v2/service_instances/123", body)
+
+		params.Limit(64, 0)(writer, req, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("rejects parameters nested deeper than the limit", func() {
+		send("PATCH", "/v2/service_instances/123", `{"parameters":{"a":{"b":[{"c":1}]}}}`)
+
+		Expect(called).To(BeFalse())
+		Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		Expect(writer.Body.String()).To(Equal("Parameters nested deeper than 3 levels"))
+	})
+
+	It("only counts nesting inside the parameters", func() {
+		send("PUT", "/v2/service_instances/123", `{"context":{"a":{"b":{"c":{}}}},"parameters":{"a":1}}`)
+
+		Expect(called).To(BeTrue())
+	})
+
+	It("ignores other operations", func() {
+		send("PUT", "/v2/service_instances/123/service_bindings/456", `{"parameters":{"a":{"b":{"c":{"d":{}}}}}}`)
+
+		Expect(called).To(BeTrue())
+	})
+
+	It("leaves malformed bodies for the broker", func() {
+		send("PUT", "/v2/service_instances/123", `not json`)
+
+		Expect(called).To(BeTrue())
+		Expect(forwardBody).To(Equal("not json"))
+	})
+})
+
+// endless reads as an unending run of b.
+type endless byte
+
+func (e endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(e)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,116 @@
+package params
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// MaxBodyBytes caps the request bodies read by Inject. Larger bodies are
+// rejected with a 413.
+const MaxBodyBytes = 1 << 20
+
+// Inject deep-merges fragment into the parameters of every provision and
+// update request. Values sent by the client win over the fragment, unless
+// overwrite is set.
+func Inject(fragment map[string]interface{}, overwrite bool) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		operation := osb.Parse(r.Method, r.URL.Path).Operation
+		if operation != osb.Provision && operation != osb.Update {
+			next(w, r)
+			return
+		}
+
+		var raw []byte
+		if r.Body != nil {
+			var err error
+			raw, err = ioutil.ReadAll(io.LimitReader(r.Body, MaxBodyBytes+1))
+			r.Body.Close()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Error reading request body"))
+				return
+			}
+			if len(raw) > MaxBodyBytes {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				w.Write([]byte(fmt.Sprintf("Request body exceeds %d bytes", MaxBodyBytes)))
+				return
+			}
+		}
+
+		body := map[string]interface{}{}
+		if len(bytes.TrimSpace(raw)) != 0 {
+			var ok bool
+			if body, ok = decodeObject(raw); !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Request body must be a JSON object"))
+				return
+			}
+		}
+
+		parameters, ok := body["parameters"].(map[string]interface{})
+		if !ok {
+			parameters = map[string]interface{}{}
+		}
+		body["parameters"] = merge(parameters, fragment, overwrite)
+
+		var merged bytes.Buffer
+		encoder := json.NewEncoder(&merged)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Error encoding request body"))
+			return
+		}
+
+		r.Body = ioutil.NopCloser(&merged)
+		r.ContentLength = int64(merged.Len())
+		r.Header.Set("Content-Length", strconv.Itoa(merged.Len()))
+
+		next(w, r)
+	})
+}
+
+// decodeObject decodes raw, keeping numbers as they were sent, and reports
+// whether it held exactly one JSON object.
+func decodeObject(raw []byte) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return object, true
+}
+
+func merge(dst, src map[string]interface{}, overwrite bool) map[string]interface{} {
+	for key, srcValue := range src {
+		dstValue, exists := dst[key]
+
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		switch {
+		case srcIsMap && dstIsMap:
+			dst[key] = merge(dstMap, srcMap, overwrite)
+		case srcIsMap && !exists:
+			dst[key] = merge(map[string]interface{}{}, srcMap, overwrite)
+		case !exists || overwrite:
+			dst[key] = srcValue
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,136 @@
+package params_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/params"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inject", func() {
+	var (
+		fragment    map[string]interface{}
+		overwrite   bool
+		forwarded   *http.Request
+		forwardBody string
+		writer      *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		fragment = map[string]interface{}{
+			"labels": map[string]interface{}{"cost-center": "cf", "owner": "platform"},
+		}
+		overwrite = false
+		forwarded = nil
+		forwardBody = ""
+		writer = httptest.NewRecorder()
+	})
+
+	var send = func(method, path string, body io.Reader) {
+		req := httptest.NewRequest(method, path, body)
+		if body == nil {
+			req.Body = nil
+		}
+
+		params.Inject(fragment, overwrite)(writer, req, func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r
+			if r.Body != nil {
+				b, _ := ioutil.ReadAll(r.Body)
+				forwardBody = string(b)
+			}
+		})
+	}
+
+	It("merges the fragment into existing parameters", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(`{"service_id":"s","parameters":{"size":"large","labels":{"team":"a"}}}`))
+
+		Expect(forwardBody).To(MatchJSON(`{
+			"service_id": "s",
+			"parameters": {"size": "large", "labels": {"team": "a", "cost-center": "cf", "owner": "platform"}}
+		}`))
+	})
+
+	It("does not overwrite values set by the client", func() {
+		send("PATCH", "/v2/service_instances/123", strings.NewReader(`{"parameters":{"labels":{"owner":"someone"}}}`))
+
+		Expect(forwardBody).To(MatchJSON(`{"parameters": {"labels": {"owner": "someone", "cost-center": "cf"}}}`))
+	})
+
+	Context("when configured to overwrite", func() {
+		BeforeEach(func() {
+			overwrite = true
+		})
+
+		It("replaces values set by the client", func() {
+			send("PATCH", "/v2/service_instances/123", strings.NewReader(`{"parameters":{"labels":{"owner":"someone"}}}`))
+
+			Expect(forwardBody).To(MatchJSON(`{"parameters": {"labels": {"owner": "platform", "cost-center": "cf"}}}`))
+		})
+	})
+
+	It("injects the parameters into a request without parameters", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(`{"service_id":"s"}`))
+
+		Expect(forwardBody).To(MatchJSON(`{"service_id": "s", "parameters": {"labels": {"cost-center": "cf", "owner": "platform"}}}`))
+	})
+
+	It("injects the parameters into an empty body", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(""))
+
+		Expect(forwardBody).To(MatchJSON(`{"parameters": {"labels": {"cost-center": "cf", "owner": "platform"}}}`))
+	})
+
+	It("injects the parameters into a request without a body", func() {
+		send("PUT", "/v2/service_instances/123", nil)
+
+		Expect(forwardBody).To(MatchJSON(`{"parameters": {"labels": {"cost-center": "cf", "owner": "platform"}}}`))
+	})
+
+	It("recomputes the content length", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(`{}`))
+
+		Expect(forwarded.ContentLength).To(Equal(int64(len(forwardBody))))
+		Expect(forwarded.Header.Get("Content-Length")).To(Equal(strconv.Itoa(len(forwardBody))))
+	})
+
+	It("leaves other endpoints alone", func() {
+		send("PUT", "/v2/service_instances/123/service_bindings/456", strings.NewReader(`{"parameters":{}}`))
+
+		Expect(forwardBody).To(Equal(`{"parameters":{}}`))
+	})
+
+	It("keeps large numbers and HTML characters as they were sent", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(`{"parameters":{"id":12345678901234567890,"query":"a<b && b>c"}}`))
+
+		Expect(forwardBody).To(ContainSubstring(`"id":12345678901234567890`))
+		Expect(forwardBody).To(ContainSubstring(`"query":"a<b && b>c"`))
+	})
+
+	DescribeTable("rejects bodies that are not JSON objects",
+		func(body string) {
+			send("PUT", "/v2/service_instances/123", strings.NewReader(body))
+
+			Expect(forwarded).To(BeNil())
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		},
+		Entry("not JSON", `not json`),
+		Entry("null", `null`),
+		Entry("an array", `[{"parameters":{}}]`),
+		Entry("trailing data", `{"parameters":{}} {}`),
+	)
+
+	It("rejects bodies larger than MaxBodyBytes", func() {
+		send("PUT", "/v2/service_instances/123", strings.NewReader(`{"parameters":{"padding":"`+strings.Repeat("a", params.MaxBodyBytes)+`"}}`))
+
+		Expect(forwarded).To(BeNil())
+		Expect(writer.Code).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+})
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// MissingAPIVersion decides what happens to requests without an
+// X-Broker-API-Version header.
+type MissingAPIVersion int
+
+const (
+	// MissingAPIVersionPassThrough forwards the request unchanged.
+	MissingAPIVersionPassThrough MissingAPIVersion = iota
+	// MissingAPIVersionInject forwards the request with a default version.
+	MissingAPIVersionInject
+	// MissingAPIVersionReject responds with 412 Precondition Failed, as the
+	// OSB spec asks brokers to.
+	MissingAPIVersionReject
+)
+
+// checkAPIVersion applies the policy to r and reports whether it may be
+// forwarded.
+func checkAPIVersion(rw http.ResponseWriter, r *http.Request, policy MissingAPIVersion, defaultVersion string) bool {
+	if r.Header.Get(osb.APIVersionHeader) != "" {
+		return true
+	}
+
+	switch policy {
+	case MissingAPIVersionInject:
+		r.Header.Set(osb.APIVersionHeader, defaultVersion)
+	case MissingAPIVersionReject:
+		rw.WriteHeader(http.StatusPreconditionFailed)
+		rw.Write([]byte("Missing " + osb.APIVersionHeader + " header"))
+		return false
+	}
+	return true
+}
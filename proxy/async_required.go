@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// asyncRequiredTransport sends mutating requests once more with
+// accepts_incomplete=true when the broker rejects them with a 422
+// AsyncRequired error.
+type asyncRequiredTransport struct {
+	next http.RoundTripper
+}
+
+func (t *asyncRequiredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if !osb.Parse(req.Method, req.URL.Path).Operation.IsMutating() || req.URL.Query().Get("accepts_incomplete") == "true" {
+		return next.RoundTrip(req)
+	}
+
+	body, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body, _ = body()
+	}
+
+	res, err := next.RoundTrip(req)
+	if err != nil || !isAsyncRequired(res) {
+		return res, err
+	}
+
+	retry := req.Clone(req.Context())
+	query := retry.URL.Query()
+	query.Set("accepts_incomplete", "true")
+	retry.URL.RawQuery = query.Encode()
+	if body != nil {
+		retry.Body, _ = body()
+	}
+
+	log.Printf("Broker requires asynchronous operation, retrying %s %s with accepts_incomplete=true\n", req.Method, req.URL.Path)
+	return next.RoundTrip(retry)
+}
+
+// isAsyncRequired reports whether res is a 422 AsyncRequired error. The body
+// is left readable either way.
+func isAsyncRequired(res *http.Response) bool {
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var brokerError struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(body, &brokerError) == nil && brokerError.Error == "AsyncRequired"
+}
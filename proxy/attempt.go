@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	// AttemptHeader tells the broker how many times the proxy has sent the
+	// current request, counting failovers and retries.
+	AttemptHeader = "X-Proxy-Attempt"
+	// RequestSequenceHeader carries a number identifying the request, shared
+	// by all its attempts and increasing with every request the proxy handles.
+	RequestSequenceHeader = "X-Proxy-Request-Sequence"
+)
+
+type attemptsKey struct{}
+
+// attempts counts the times one request was sent to a broker.
+type attempts struct {
+	sequence uint64
+	count    int32
+}
+
+func withAttempts(ctx context.Context, sequence uint64) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, &attempts{sequence: sequence})
+}
+
+// attemptTransport sits closest to the broker, below failover and retries, to
+// number every request actually sent.
+type attemptTransport struct {
+	next http.RoundTripper
+}
+
+func (t *attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	a, ok := req.Context().Value(attemptsKey{}).(*attempts)
+	if !ok {
+		return next.RoundTrip(req)
+	}
+
+	attempt := req.Clone(req.Context())
+	attempt.Header.Set(AttemptHeader, strconv.Itoa(int(atomic.AddInt32(&a.count, 1))))
+	attempt.Header.Set(RequestSequenceHeader, strconv.FormatUint(a.sequence, 10))
+	return next.RoundTrip(attempt)
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	b3Single  = "b3"
+	b3TraceID = "X-B3-TraceId"
+	b3SpanID  = "X-B3-SpanId"
+	b3Sampled = "X-B3-Sampled"
+)
+
+// ensureB3 starts a Zipkin trace for requests that arrive without B3 headers,
+// so the broker's spans can be tied to the request. B3 headers sent by the
+// platform, single or multi, are forwarded as they are.
+func ensureB3(req *http.Request) {
+	if req.Header.Get(b3Single) != "" || req.Header.Get(b3TraceID) != "" {
+		return
+	}
+
+	req.Header.Set(b3TraceID, randomHex(16))
+	req.Header.Set(b3SpanID, randomHex(8))
+	req.Header.Set(b3Sampled, "1")
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxReplayBodyBytes caps the request bodies buffered for replay unless
+// WithMaxReplayBodyBytes says otherwise.
+const DefaultMaxReplayBodyBytes = 1 << 20
+
+var (
+	errBodyTooLarge    = errors.New("Request body is too large")
+	errBodyReadTimeout = errors.New("Timed out reading the request body")
+)
+
+// bufferBody reads the body of r, up to max bytes, so that it can be sent
+// again through r.GetBody. Features sending a request more than once rely on
+// it, everything else streams the body. With a timeout, a client that does not
+// finish uploading the body in time gets errBodyReadTimeout; the read carries
+// on in the background until the client sends more or goes away, but r is
+// left alone.
+func bufferBody(r *http.Request, max int64, timeout time.Duration) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	type result struct {
+		body []byte
+		err  error
+	}
+	read := make(chan result, 1)
+	go func() {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+		read <- result{body, err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var body []byte
+	select {
+	case res := <-read:
+		r.Body.Close()
+		if res.err != nil {
+			return res.err
+		}
+		body = res.body
+	case <-expired:
+		return errBodyReadTimeout
+	}
+	if int64(len(body)) > max {
+		return errBodyTooLarge
+	}
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.Body, _ = r.GetBody()
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+// writeBodyError answers a request whose body bufferBody failed to read.
+func writeBodyError(rw http.ResponseWriter, r *http.Request, err error, timeout time.Duration) {
+	switch err {
+	case errBodyTooLarge:
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		rw.Write([]byte(err.Error()))
+	case errBodyReadTimeout:
+		log.Printf("Timed out reading the request body: method=%s path=%s timeout=%s\n", r.Method, r.URL.Path, timeout)
+		rw.Header().Set("Connection", "close")
+		rw.WriteHeader(http.StatusRequestTimeout)
+		rw.Write([]byte(err.Error()))
+	default:
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("Failed to read request body: " + err.Error()))
+	}
+}
+
+// replayableBody returns a function giving a fresh copy of the body of req for
+// each attempt, or nil when req has no body.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	if req.GetBody == nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	return req.GetBody, nil
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/auth"
+)
+
+// BrokerOverrideHeader names an alternate broker, e.g. a canary, for a single
+// request.
+const BrokerOverrideHeader = "X-Debug-Broker-URL"
+
+// maxOverrideProxies bounds the reverse proxies BrokerOverride keeps for the
+// brokers it was most recently asked for.
+const maxOverrideProxies = 100
+
+// BrokerOverride sends requests carrying X-Debug-Broker-URL to the broker it
+// names instead of handing them on. Only requests authenticated as admin, see
+// auth.AdminAuth, may do so, and only to one of allowedHosts; anything else
+// carrying the header is rejected with a 403. An allowed host without a port
+// only allows the default port of the scheme. The header is never forwarded.
+// Requests are proxied with opts, so it belongs after the token handler.
+func BrokerOverride(allowedHosts []string, opts ...Option) negroni.HandlerFunc {
+	allowed := make(map[string]bool, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	proxies := &overrideProxies{opts: opts, recent: list.New(), elements: map[string]*list.Element{}}
+
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		override := r.Header.Get(BrokerOverrideHeader)
+		if override == "" {
+			next(rw, r)
+			return
+		}
+		r.Header.Del(BrokerOverrideHeader)
+
+		if !auth.IsAdmin(r) {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte("Overriding the broker requires admin credentials"))
+			return
+		}
+
+		brokerURL, err := url.ParseRequestURI(override)
+		if err != nil || !overrideAllowed(brokerURL, allowed) {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte("Broker override not allowed: " + override))
+			return
+		}
+
+		proxies.get(brokerURL)(rw, r, func(http.ResponseWriter, *http.Request) {})
+	})
+}
+
+// overrideAllowed reports whether brokerURL is an http or https URL whose host
+// and port are allowed, either explicitly or, for the default port of its
+// scheme, by the host alone.
+func overrideAllowed(brokerURL *url.URL, allowed map[string]bool) bool {
+	var defaultPort string
+	switch brokerURL.Scheme {
+	case "http":
+		defaultPort = "80"
+	case "https":
+		defaultPort = "443"
+	default:
+		return false
+	}
+
+	host, port := strings.ToLower(brokerURL.Hostname()), brokerURL.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	if allowed[net.JoinHostPort(host, port)] {
+		return true
+	}
+	return port == defaultPort && allowed[host]
+}
+
+// overrideProxies keeps a reverse proxy for each of the most recently used
+// override URLs.
+type overrideProxies struct {
+	opts []Option
+
+	mu       sync.Mutex
+	recent   *list.List
+	elements map[string]*list.Element
+}
+
+type overrideProxy struct {
+	url     string
+	handler negroni.HandlerFunc
+}
+
+func (p *overrideProxies) get(brokerURL *url.URL) negroni.HandlerFunc {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := brokerURL.String()
+	if e, ok := p.elements[key]; ok {
+		p.recent.MoveToFront(e)
+		return e.Value.(*overrideProxy).handler
+	}
+
+	if p.recent.Len() >= maxOverrideProxies {
+		oldest := p.recent.Back()
+		p.recent.Remove(oldest)
+		delete(p.elements, oldest.Value.(*overrideProxy).url)
+	}
+
+	entry := &overrideProxy{url: key, handler: ReverseProxy(brokerURL, p.opts...)}
+	p.elements[key] = p.recent.PushFront(entry)
+	return entry.handler
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import "sync"
+
+// DefaultCopyBufferSize is the size of the buffers response bodies are copied
+// to the client with, unless WithCopyBufferSize says otherwise.
+const DefaultCopyBufferSize = 32 * 1024
+
+// bufferPool reuses the buffers the reverse proxy copies response bodies
+// with, instead of allocating one per request.
+//
+// Buffers are pooled as *[]byte so putting one back does not allocate. As
+// httputil.BufferPool deals in plain slices, the pointers a buffer is taken
+// out of are kept in holders and reused for the next buffer put back.
+type bufferPool struct {
+	buffers sync.Pool
+	holders sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	return &bufferPool{
+		buffers: sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, size)
+				return &buf
+			},
+		},
+		holders: sync.Pool{
+			New: func() interface{} {
+				return new([]byte)
+			},
+		},
+	}
+}
+
+func (p *bufferPool) Get() []byte {
+	holder := p.buffers.Get().(*[]byte)
+	buf := *holder
+	*holder = nil
+	p.holders.Put(holder)
+	return buf
+}
+
+func (p *bufferPool) Put(buf []byte) {
+	holder := p.holders.Get().(*[]byte)
+	*holder = buf
+	p.buffers.Put(holder)
+}
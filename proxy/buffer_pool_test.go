@@ -0,0 +1,75 @@
+package proxy_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// readSizeRecorder remembers the largest buffer it was asked to read into.
+type readSizeRecorder struct {
+	io.Reader
+	largest int
+}
+
+func (r *readSizeRecorder) Read(p []byte) (int, error) {
+	if len(p) > r.largest {
+		r.largest = len(p)
+	}
+	return r.Reader.Read(p)
+}
+
+type readerDoer struct {
+	body io.Reader
+}
+
+func (d readerDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(d.body),
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+var _ = Describe("Copy buffer size", func() {
+	var body *readSizeRecorder
+
+	BeforeEach(func() {
+		body = &readSizeRecorder{Reader: bytes.NewReader(bytes.Repeat([]byte("a"), 1<<20))}
+	})
+
+	var serve = func(opts ...proxy.Option) *httptest.ResponseRecorder {
+		brokerURL, _ := url.Parse("http://broker.example.com")
+		opts = append(opts, proxy.WithHTTPDoer(readerDoer{body: body}))
+
+		req := httptest.NewRequest("GET", "/v2/catalog", nil)
+		req.Header.Set("X-Broker-API-Version", "2.14")
+		rec := httptest.NewRecorder()
+		proxy.ReverseProxy(brokerURL, opts...)(rec, req, func(http.ResponseWriter, *http.Request) {})
+		return rec
+	}
+
+	It("copies with DefaultCopyBufferSize buffers by default", func() {
+		rec := serve()
+
+		Expect(rec.Body.Len()).To(Equal(1 << 20))
+		Expect(body.largest).To(Equal(proxy.DefaultCopyBufferSize))
+	})
+
+	It("copies with buffers of the configured size", func() {
+		rec := serve(proxy.WithCopyBufferSize(128 << 10))
+
+		Expect(rec.Body.Len()).To(Equal(1 << 20))
+		Expect(body.largest).To(Equal(128 << 10))
+	})
+})
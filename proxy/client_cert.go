@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClientCertHeader is the header WithClientCertForwarding uses by default, in
+// the XFCC format of Envoy.
+const ClientCertHeader = "X-Forwarded-Client-Cert"
+
+// forwardClientCert describes the TLS client certificate of req to the broker
+// in header. Any value the client sent in header itself is dropped, so the
+// broker can trust it.
+func forwardClientCert(req *http.Request, header string) {
+	req.Header.Del(header)
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return
+	}
+	req.Header.Set(header, xfcc(req.TLS.PeerCertificates[0]))
+}
+
+// xfcc formats cert as an XFCC element, e.g.
+// Hash=ab12…;Subject="CN=platform";URI=spiffe://cf/platform;DNS=platform.internal
+func xfcc(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	fields := []string{
+		"Hash=" + hex.EncodeToString(hash[:]),
+		"Subject=" + strconv.Quote(cert.Subject.String()),
+	}
+	for _, uri := range cert.URIs {
+		fields = append(fields, "URI="+uri.String())
+	}
+	for _, name := range cert.DNSNames {
+		fields = append(fields, "DNS="+name)
+	}
+	return strings.Join(fields, ";")
+}
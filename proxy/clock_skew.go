@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// warnClockSkew logs a warning when the Date header of a broker response is
+// more than threshold away from the proxy's clock. It warns once when the
+// skew appears and again only after a response showed it gone, so a broker
+// with a wrong clock does not flood the logs.
+func warnClockSkew(threshold time.Duration, now func() time.Time) func(*http.Response) error {
+	var skewed int32
+
+	return func(res *http.Response) error {
+		date, err := http.ParseTime(res.Header.Get("Date"))
+		if err != nil {
+			return nil
+		}
+
+		skew := date.Sub(now())
+		if skew <= threshold && skew >= -threshold {
+			atomic.StoreInt32(&skewed, 0)
+			return nil
+		}
+
+		if atomic.CompareAndSwapInt32(&skewed, 0, 1) {
+			log.Printf("Broker clock appears skewed: method=%s path=%s date=%s skew=%s threshold=%s\n", res.Request.Method, res.Request.URL.Path, res.Header.Get("Date"), skew.Truncate(time.Second), threshold)
+		}
+		return nil
+	}
+}
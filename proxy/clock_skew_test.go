@@ -0,0 +1,85 @@
+package proxy_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Broker clock skew", func() {
+	var (
+		brokerServer *ghttp.Server
+		handler      func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+		clock        *fakeClock
+		logs         *gbytes.Buffer
+		brokerDate   time.Time
+	)
+
+	BeforeEach(func() {
+		brokerDate = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+		brokerServer = ghttp.NewServer()
+		brokerServer.RouteToHandler("GET", "/v2/catalog", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", brokerDate.Format(http.TimeFormat))
+			w.Write([]byte(`{"services":[]}`))
+		})
+		brokerURL, _ := url.ParseRequestURI(brokerServer.URL())
+
+		clock = &fakeClock{now: brokerDate}
+		handler = proxy.ReverseProxy(brokerURL, proxy.WithClock(clock), proxy.WithClockSkewWarning(time.Minute))
+
+		logs = gbytes.NewBuffer()
+		log.SetOutput(logs)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+		brokerServer.Close()
+	})
+
+	var get = func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/v2/catalog", nil)
+		w := httptest.NewRecorder()
+		handler(w, req, func(http.ResponseWriter, *http.Request) {})
+		return w
+	}
+
+	It("warns once while the broker clock is skewed beyond the threshold", func() {
+		clock.now = brokerDate.Add(5 * time.Minute)
+
+		Expect(get().Body.String()).To(Equal(`{"services":[]}`))
+		get()
+
+		Expect(logs).To(gbytes.Say(`Broker clock appears skewed: method=GET path=/v2/catalog date=Thu, 15 Oct 2026 12:00:00 GMT skew=-5m0s threshold=1m0s`))
+		Expect(logs).NotTo(gbytes.Say("skewed"))
+	})
+
+	It("warns again when the skew returns after it was gone", func() {
+		clock.now = brokerDate.Add(-5 * time.Minute)
+		get()
+		clock.now = brokerDate
+		get()
+		clock.now = brokerDate.Add(-5 * time.Minute)
+		get()
+
+		Expect(logs).To(gbytes.Say("skew=5m0s"))
+		Expect(logs).To(gbytes.Say("skew=5m0s"))
+	})
+
+	It("stays quiet within the threshold", func() {
+		clock.now = brokerDate.Add(30 * time.Second)
+
+		get()
+
+		Expect(logs.Contents()).To(BeEmpty())
+	})
+})
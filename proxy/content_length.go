@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ContentLengthMismatch controls what happens to broker responses whose body
+// is shorter than their Content-Length.
+type ContentLengthMismatch int
+
+const (
+	// ContentLengthReject discards such responses, the client receives a 502.
+	ContentLengthReject ContentLengthMismatch = iota
+	// ContentLengthRecompute forwards the bytes that were received, with a
+	// Content-Length matching them.
+	ContentLengthRecompute
+)
+
+// checkContentLength reads the whole broker response so the client is sent a
+// Content-Length matching the body, whatever the broker declared. Responses
+// without a Content-Length get one too.
+func checkContentLength(policy ContentLengthMismatch) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if isEventStream(res) || res.Request.Method == http.MethodHead ||
+			res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err == io.ErrUnexpectedEOF && policy == ContentLengthRecompute {
+			err = nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("Broker response body was shorter than its Content-Length of %d bytes", res.ContentLength)
+		}
+		if err != nil {
+			return err
+		}
+
+		setBody(res, body)
+		return nil
+	}
+}
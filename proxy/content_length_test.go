@@ -0,0 +1,139 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Content-Length checks", func() {
+	var (
+		listener    net.Listener
+		brokerURL   *url.URL
+		noOpHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+	)
+
+	// respondRaw makes the broker answer the next request with response,
+	// written as is, and close the connection.
+	var respondRaw = func(response string) {
+		go func() {
+			defer GinkgoRecover()
+			conn, err := listener.Accept()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			http.ReadRequest(bufio.NewReader(conn))
+			conn.Write([]byte(response))
+		}()
+	}
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		brokerURL, _ = url.Parse("http://" + listener.Addr().String())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	var proxyRequest = func(policy proxy.ContentLengthMismatch) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/v2/catalog", nil)
+		w := httptest.NewRecorder()
+		proxy.ReverseProxy(brokerURL, proxy.WithContentLengthCheck(policy))(w, req, noOpHandler)
+		return w
+	}
+
+	Context("when the body is shorter than the Content-Length", func() {
+		BeforeEach(func() {
+			respondRaw("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n{\"services\":[]}")
+		})
+
+		It("forwards the received body with a matching length when recomputing", func() {
+			w := proxyRequest(proxy.ContentLengthRecompute)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal(`{"services":[]}`))
+			Expect(w.Header().Get("Content-Length")).To(Equal("15"))
+		})
+
+		It("responds with a 502 when rejecting", func() {
+			w := proxyRequest(proxy.ContentLengthReject)
+
+			Expect(w.Code).To(Equal(http.StatusBadGateway))
+			Expect(w.Body.String()).To(ContainSubstring("Broker response body was shorter than its Content-Length of 100 bytes"))
+		})
+	})
+
+	It("sets the length of bodies delimited by the broker closing the connection", func() {
+		respondRaw("HTTP/1.1 200 OK\r\nConnection: close\r\n\r\n{\"services\":[]}")
+
+		w := proxyRequest(proxy.ContentLengthReject)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal(`{"services":[]}`))
+		Expect(w.Header().Get("Content-Length")).To(Equal("15"))
+	})
+
+	It("forwards bodies matching their Content-Length untouched", func() {
+		respondRaw("HTTP/1.1 200 OK\r\nContent-Length: 15\r\n\r\n{\"services\":[]}")
+
+		w := proxyRequest(proxy.ContentLengthReject)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal(`{"services":[]}`))
+		Expect(w.Header().Get("Content-Length")).To(Equal("15"))
+	})
+
+	Context("when the broker closes the connection mid-body", func() {
+		var (
+			proxyServer *httptest.Server
+			logs        *gbytes.Buffer
+		)
+
+		BeforeEach(func() {
+			logs = gbytes.NewBuffer()
+			log.SetOutput(logs)
+
+			n := negroni.New()
+			n.Use(proxy.ReverseProxy(brokerURL))
+			proxyServer = httptest.NewServer(n)
+			proxyServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+			// Larger than the server's write buffer, so the headers reach the
+			// client before the body is cut short.
+			respondRaw("HTTP/1.1 200 OK\r\nContent-Length: 16384\r\n\r\n" + strings.Repeat("x", 8192))
+		})
+
+		AfterEach(func() {
+			proxyServer.Close()
+			log.SetOutput(os.Stderr)
+		})
+
+		It("logs the truncation and aborts the client connection", func() {
+			res, err := http.Get(proxyServer.URL + "/v2/catalog")
+			Expect(err).NotTo(HaveOccurred())
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+			_, err = ioutil.ReadAll(res.Body)
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			Expect(logs).To(gbytes.Say("Broker response truncated: method=GET path=/v2/catalog status=200 bytes=8192 error=unexpected EOF"))
+		})
+	})
+})
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// enforceJSONContentType labels OSB responses as JSON when the broker left out
+// the content type, or sent a non JSON one, for a body that is valid JSON.
+func enforceJSONContentType(res *http.Response) error {
+	if osb.Parse(res.Request.Method, res.Request.URL.Path).Operation == osb.Unknown {
+		return nil
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && isJSONMediaType(mediaType) {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if json.Valid(body) {
+		res.Header.Set("Content-Type", "application/json")
+	}
+
+	return nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || (len(mediaType) > 5 && mediaType[len(mediaType)-5:] == "+json")
+}
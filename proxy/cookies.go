@@ -0,0 +1,28 @@
+package proxy
+
+import "net/http"
+
+// Cookies controls whether cookies pass through the proxy. OSB does not use
+// them, so by default they are stripped in both directions.
+type Cookies int
+
+const (
+	// CookiesStrip removes Cookie from requests to the broker and Set-Cookie
+	// from its responses.
+	CookiesStrip Cookies = iota
+	// CookiesPreserve forwards cookies both ways, for broker dashboards that
+	// keep a session.
+	CookiesPreserve
+)
+
+func stripRequestCookies(req *http.Request, policy Cookies) {
+	if policy == CookiesStrip {
+		req.Header.Del("Cookie")
+	}
+}
+
+func stripResponseCookies(res *http.Response, policy Cookies) {
+	if policy == CookiesStrip {
+		res.Header.Del("Set-Cookie")
+	}
+}
@@ -0,0 +1,25 @@
+package proxy
+
+import "net/http"
+
+// CorrelationIDHeader carries an id tying together the logs of the platform,
+// the proxy, the broker and whatever the broker calls in turn.
+const CorrelationIDHeader = "X-Correlation-Id"
+
+// ensureCorrelationID gives r a correlation id unless it has one already and
+// echoes it back to the client.
+func ensureCorrelationID(rw http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(CorrelationIDHeader)
+	if id == "" {
+		id = randomHex(16)
+		r.Header.Set(CorrelationIDHeader, id)
+	}
+	rw.Header().Set(CorrelationIDHeader, id)
+}
+
+// dropBrokerCorrelationID removes the id a broker echoes itself, which
+// would otherwise be added to the one already set for the client.
+func dropBrokerCorrelationID(res *http.Response) error {
+	res.Header.Del(CorrelationIDHeader)
+	return nil
+}
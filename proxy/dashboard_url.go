@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// rewriteDashboardURL points dashboard URLs on the broker host at externalURL
+// instead, keeping the path and query of the original URL.
+func rewriteDashboardURL(externalURL *url.URL) func(*http.Response) error {
+	return func(res *http.Response) error {
+		switch osb.Parse(res.Request.Method, res.Request.URL.Path).Operation {
+		case osb.Provision, osb.Update, osb.GetInstance:
+		default:
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil
+		}
+
+		var dashboardURL string
+		if err := json.Unmarshal(fields["dashboard_url"], &dashboardURL); err != nil {
+			return nil
+		}
+
+		parsed, err := url.Parse(dashboardURL)
+		if err != nil || parsed.Host != res.Request.URL.Host {
+			return nil
+		}
+
+		parsed.Scheme = externalURL.Scheme
+		parsed.Host = externalURL.Host
+		parsed.Path = strings.TrimSuffix(externalURL.Path, "/") + parsed.Path
+		parsed.RawPath = ""
+
+		fields["dashboard_url"], err = json.Marshal(parsed.String())
+		if err != nil {
+			return err
+		}
+		body, err = json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res.ContentLength = int64(len(body))
+		res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+}
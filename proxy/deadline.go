@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DeadlineHeader tells the broker how many milliseconds remain before the
+	// proxy gives up on the request.
+	DeadlineHeader = "X-Request-Timeout-Ms"
+	// GRPCTimeoutHeader carries the remaining time in the gRPC format, e.g.
+	// 1500m for 1.5 seconds.
+	GRPCTimeoutHeader = "grpc-timeout"
+)
+
+// deadlineTransport sits closest to the broker, like attemptTransport, so
+// every attempt carries the time remaining when it is actually sent.
+type deadlineTransport struct {
+	next   http.RoundTripper
+	header string
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return next.RoundTrip(req)
+	}
+
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		remaining = 1
+	}
+	value := strconv.FormatInt(remaining, 10)
+	if strings.EqualFold(t.header, GRPCTimeoutHeader) {
+		value += "m"
+	}
+
+	attempt := req.Clone(req.Context())
+	attempt.Header.Set(t.header, value)
+	return next.RoundTrip(attempt)
+}
@@ -0,0 +1,19 @@
+package proxy
+
+import "net/http"
+
+//go:generate counterfeiter . HTTPDoer
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// doerTransport lets an HTTPDoer, such as an *http.Client, carry the requests
+// of the reverse proxy.
+type doerTransport struct {
+	doer HTTPDoer
+}
+
+func (t doerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.RequestURI = ""
+	return t.doer.Do(req)
+}
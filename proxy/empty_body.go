@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// emptyBodyDefaults holds the minimal valid bodies substituted for empty 200
+// responses. Operations not listed here get an empty JSON object.
+var emptyBodyDefaults = map[osb.Operation]string{
+	osb.Catalog: `{"services":[]}`,
+}
+
+// defaultEmptyBody replaces an empty 200 response body with a minimal JSON
+// body for the given operations, for brokers that send nothing at all.
+func defaultEmptyBody(operations []osb.Operation) func(*http.Response) error {
+	enabled := map[osb.Operation]bool{}
+	for _, operation := range operations {
+		enabled[operation] = true
+	}
+
+	return func(res *http.Response) error {
+		operation := osb.Parse(res.Request.Method, res.Request.URL.Path).Operation
+		if res.StatusCode != http.StatusOK || !enabled[operation] {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			body = []byte(`{}`)
+			if substitute, ok := emptyBodyDefaults[operation]; ok {
+				body = []byte(substitute)
+			}
+			res.Header.Set("Content-Type", "application/json")
+		}
+
+		setBody(res, body)
+		return nil
+	}
+}
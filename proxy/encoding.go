@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDecompressedBytes caps the size compressed broker responses may
+// expand to when decompressed for transforms, unless WithMaxDecompressedBytes
+// says otherwise.
+const DefaultMaxDecompressedBytes = 16 << 20
+
+// transformDecoded runs transforms on the decoded body of res. A gzip or
+// deflate encoded body is decompressed first, up to maxDecompressed bytes, and
+// compressed again afterwards when the client accepts the encoding, otherwise
+// it is sent as plain text.
+func transformDecoded(res *http.Response, transforms []func(*http.Response) error, maxDecompressed int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" {
+		if res.Uncompressed {
+			// The transport asked for gzip itself and decompressed the body.
+			if err := limitUncompressed(res, maxDecompressed); err != nil {
+				return err
+			}
+		}
+		return runTransforms(res, transforms)
+	}
+
+	body, err := decompress(res.Body, encoding, maxDecompressed)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	res.Header.Del("Content-Encoding")
+	setBody(res, body)
+
+	if err := runTransforms(res, transforms); err != nil {
+		return err
+	}
+
+	if !acceptsEncoding(res.Request.Header.Get("Accept-Encoding"), encoding) {
+		return nil
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	body, err = compress(body, encoding)
+	if err != nil {
+		return err
+	}
+	res.Header.Set("Content-Encoding", encoding)
+	setBody(res, body)
+	return nil
+}
+
+func runTransforms(res *http.Response, transforms []func(*http.Response) error) error {
+	for _, transform := range transforms {
+		if err := transform(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setBody(res *http.Response, body []byte) {
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// decompress fails once the decoded body grows beyond max bytes, so a small
+// compression bomb cannot exhaust memory.
+func decompress(r io.Reader, encoding string, max int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	if encoding == "gzip" {
+		reader, err = gzip.NewReader(r)
+	} else {
+		reader, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(reader, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, decompressedTooLarge(max)
+	}
+	return body, nil
+}
+
+func limitUncompressed(res *http.Response, max int64) error {
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, max+1))
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		return decompressedTooLarge(max)
+	}
+	setBody(res, body)
+	return nil
+}
+
+func decompressedTooLarge(max int64) error {
+	return fmt.Errorf("Decompressed broker response exceeded the maximum size of %d bytes", max)
+}
+
+func compress(body []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	if encoding == "gzip" {
+		writer = gzip.NewWriter(&buf)
+	} else {
+		writer = zlib.NewWriter(&buf)
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value allows
+// encoding, ignoring codings the client disabled with q=0.
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != encoding && coding != "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		return accepted
+	}
+	return false
+}
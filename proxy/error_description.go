@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// sanitizeErrorDescriptions replaces whatever matches one of patterns in the
+// description of OSB error bodies with [REDACTED]. The error code and any
+// other fields are forwarded as they are.
+func sanitizeErrorDescriptions(patterns []*regexp.Regexp) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if res.StatusCode < http.StatusBadRequest {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		var fields map[string]json.RawMessage
+		var description string
+		if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields["description"], &description) != nil {
+			setBody(res, body)
+			return nil
+		}
+
+		sanitized := description
+		for _, pattern := range patterns {
+			sanitized = pattern.ReplaceAllLiteralString(sanitized, redact.Redacted)
+		}
+		if sanitized != description {
+			if fields["description"], err = json.Marshal(sanitized); err != nil {
+				return err
+			}
+			if body, err = json.Marshal(fields); err != nil {
+				return err
+			}
+		}
+
+		setBody(res, body)
+		return nil
+	}
+}
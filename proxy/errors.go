@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/ratelimit"
+)
+
+const (
+	errorCanceled    = "canceled"
+	errorTimeout     = "timeout"
+	errorRateLimited = "rate_limited"
+	errorUnreachable = "unreachable"
+	errorPanic       = "panic"
+)
+
+// classify tells apart the reasons a request to the broker failed.
+func classify(r *http.Request, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		return errorCanceled
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return errorTimeout
+	case errors.Is(err, ratelimit.ErrDeadlineExceeded):
+		return errorRateLimited
+	}
+	return errorUnreachable
+}
+
+// ErrorCounter counts failed requests to the broker by reason: canceled,
+// timeout, rate_limited and unreachable, and requests that panicked in the
+// proxy itself when given to Recover.
+type ErrorCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func NewErrorCounter() *ErrorCounter {
+	return &ErrorCounter{counts: map[string]uint64{}}
+}
+
+func (c *ErrorCounter) Counts() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]uint64, len(c.counts))
+	for reason, n := range c.counts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+func (c *ErrorCounter) count(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[reason]++
+}
@@ -0,0 +1,14 @@
+package proxy
+
+import (
+	"mime"
+	"net/http"
+)
+
+// isEventStream reports whether res is a server-sent events stream. Such
+// responses may never end, so they are streamed to the client as they arrive
+// and skip anything that reads the whole body.
+func isEventStream(res *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
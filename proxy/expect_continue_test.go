@@ -0,0 +1,102 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Expect: 100-continue", func() {
+	var (
+		brokerServer *ghttp.Server
+		proxyServer  *httptest.Server
+		conn         net.Conn
+		reader       *bufio.Reader
+	)
+
+	BeforeEach(func() {
+		brokerServer = ghttp.NewServer()
+		brokerURL, err := url.ParseRequestURI(brokerServer.URL())
+		Expect(err).ToNot(HaveOccurred())
+
+		n := negroni.New()
+		n.Use(proxy.ReverseProxy(brokerURL))
+		proxyServer = httptest.NewServer(n)
+
+		conn, err = net.Dial("tcp", proxyServer.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		reader = bufio.NewReader(conn)
+
+		_, err = conn.Write([]byte("PUT /v2/service_instances/123 HTTP/1.1\r\n" +
+			"Host: proxy\r\n" +
+			"Content-Type: application/json\r\n" +
+			"Content-Length: 20\r\n" +
+			"Expect: 100-continue\r\n\r\n"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		proxyServer.Close()
+		brokerServer.Close()
+	})
+
+	var readStatusLine = func() string {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		return line
+	}
+
+	Context("when the broker accepts the request", func() {
+		BeforeEach(func() {
+			brokerServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("Expect", "100-continue"),
+				ghttp.VerifyBody([]byte(`{"service_id":"abc"}`)),
+				ghttp.RespondWith(http.StatusCreated, "{}"),
+			))
+		})
+
+		It("relays the 100 Continue, sends the body and relays the final response", func() {
+			Expect(readStatusLine()).To(Equal("HTTP/1.1 100 Continue\r\n"))
+			Expect(readStatusLine()).To(Equal("\r\n"))
+
+			_, err := conn.Write([]byte(`{"service_id":"abc"}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := http.ReadResponse(reader, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusCreated))
+
+			body, _ := ioutil.ReadAll(res.Body)
+			Expect(string(body)).To(Equal("{}"))
+			Expect(brokerServer.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Context("when the broker rejects the request before the body is sent", func() {
+		BeforeEach(func() {
+			brokerServer.AppendHandlers(ghttp.RespondWith(http.StatusUnprocessableEntity, `{"error":"AsyncRequired"}`))
+		})
+
+		It("relays the final response without asking for the body", func() {
+			res, err := http.ReadResponse(reader, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+
+			body, _ := ioutil.ReadAll(res.Body)
+			Expect(string(body)).To(Equal(`{"error":"AsyncRequired"}`))
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// failoverTransport retries requests against equivalent fallback brokers when
+// a broker cannot be reached or, for the idempotent DefaultRetryMethods,
+// answers with a 5xx, as the broker may have acted on a request it failed.
+// Fallbacks serve the paths of the primary broker below their own base path.
+type failoverTransport struct {
+	next        http.RoundTripper
+	primary     *url.URL
+	fallbacks   []*url.URL
+	maxAttempts int
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	body, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	brokers := append([]*url.URL{req.URL}, t.fallbacks...)
+	if t.maxAttempts > 0 && t.maxAttempts < len(brokers) {
+		brokers = brokers[:t.maxAttempts]
+	}
+
+	var res *http.Response
+	for i, broker := range brokers {
+		attempt := req.Clone(req.Context())
+		if i > 0 {
+			attempt.URL = t.fallbackURL(req.URL, broker)
+			attempt.Host = broker.Host
+		}
+		if body != nil {
+			attempt.Body, _ = body()
+		}
+
+		res, err = next.RoundTrip(attempt)
+		if err == nil && (res.StatusCode < http.StatusInternalServerError || !idempotent(req.Method)) {
+			return res, nil
+		}
+
+		if i == len(brokers)-1 || req.Context().Err() != nil {
+			break
+		}
+
+		if err != nil {
+			log.Printf("Broker %s unreachable, failing over to %s: %s\n", broker.Host, brokers[i+1].Host, redact.Error(err, req.Header))
+		} else {
+			log.Printf("Broker %s responded with %d, failing over to %s\n", broker.Host, res.StatusCode, brokers[i+1].Host)
+			res.Body.Close()
+		}
+	}
+
+	return res, err
+}
+
+// fallbackURL moves u from the primary broker to broker, keeping its path
+// below the base path of the primary.
+func (t *failoverTransport) fallbackURL(u, broker *url.URL) *url.URL {
+	moved := *u
+	moved.Scheme = broker.Scheme
+	moved.Host = broker.Host
+
+	path := strings.TrimPrefix(u.EscapedPath(), strings.TrimSuffix(t.primary.EscapedPath(), "/"))
+	moved.RawPath = strings.TrimSuffix(broker.EscapedPath(), "/") + path
+	if unescaped, err := url.PathUnescape(moved.RawPath); err == nil {
+		moved.Path = unescaped
+	}
+	return &moved
+}
+
+func idempotent(method string) bool {
+	for _, m := range DefaultRetryMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
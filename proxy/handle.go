@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+)
+
+// HandleRequest runs req through handler, usually a negroni chain ending in
+// ReverseProxy, without an HTTP server and returns the response the handler
+// would have written to the client. It lets embedders assert end to end
+// behaviour against an injected HTTPDoer.
+func HandleRequest(handler http.Handler, req *http.Request) (*http.Response, error) {
+	if req == nil || req.URL == nil {
+		return nil, errors.New("Request must have a URL")
+	}
+
+	if req.RequestURI == "" {
+		req.RequestURI = req.URL.RequestURI()
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	res.Request = req
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy/proxyfakes"
+	"code.cloudfoundry.org/gcp-broker-proxy/token"
+	"code.cloudfoundry.org/gcp-broker-proxy/token/tokenfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("HandleRequest", func() {
+	var (
+		doerFake *proxyfakes.FakeHTTPDoer
+		handler  http.Handler
+	)
+
+	BeforeEach(func() {
+		brokerURL, _ := url.ParseRequestURI("https://broker.example.com")
+
+		doerFake = new(proxyfakes.FakeHTTPDoer)
+		doerFake.DoStub = func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"dashboard_url":"x"}`)),
+			}, nil
+		}
+
+		tokenFake := new(tokenfakes.FakeTokenRetriever)
+		tokenFake.GetTokenReturns(&oauth2.Token{AccessToken: "my-token"}, nil)
+
+		handler = negroni.New(
+			token.TokenHandler(tokenFake),
+			proxy.ReverseProxy(brokerURL, proxy.WithHTTPDoer(doerFake)),
+		)
+	})
+
+	var newRequest = func() *http.Request {
+		req, _ := http.NewRequest("PUT", "/v2/service_instances/123", strings.NewReader(`{"service_id":"abc"}`))
+		return req
+	}
+
+	It("runs the request through the full pipeline", func() {
+		res, err := proxy.HandleRequest(handler, newRequest())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(doerFake.DoCallCount()).To(Equal(1))
+		outReq := doerFake.DoArgsForCall(0)
+		Expect(outReq.URL.String()).To(Equal("https://broker.example.com/v2/service_instances/123"))
+		Expect(outReq.Header.Get("Authorization")).To(Equal("Bearer my-token"))
+
+		Expect(res.StatusCode).To(Equal(http.StatusCreated))
+		body, _ := ioutil.ReadAll(res.Body)
+		Expect(string(body)).To(Equal(`{"dashboard_url":"x"}`))
+	})
+
+	It("returns what the handler writes when served", func() {
+		res, err := proxy.HandleRequest(handler, newRequest())
+		Expect(err).NotTo(HaveOccurred())
+		handled, _ := ioutil.ReadAll(res.Body)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest())
+
+		Expect(res.StatusCode).To(Equal(w.Code))
+		Expect(res.Header).To(Equal(w.Header()))
+		Expect(string(handled)).To(Equal(w.Body.String()))
+	})
+
+	It("errors on a request without a URL", func() {
+		_, err := proxy.HandleRequest(handler, &http.Request{})
+		Expect(err).To(MatchError("Request must have a URL"))
+	})
+})
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+const concurrencyErrorBody = `{"error":"ConcurrencyError","description":"Another operation for this service instance is in progress."}`
+
+// instanceGuard lets only one mutating request per service instance reach the
+// broker at a time.
+type instanceGuard struct {
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+func newInstanceGuard() *instanceGuard {
+	return &instanceGuard{inFlight: map[string]struct{}{}}
+}
+
+// acquire reports whether r may proceed. When it may, release must be called
+// once the request is done.
+func (g *instanceGuard) acquire(r *http.Request) (release func(), ok bool) {
+	route := osb.Parse(r.Method, r.URL.Path)
+	if !route.Operation.IsMutating() {
+		return func() {}, true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, busy := g.inFlight[route.InstanceID]; busy {
+		return nil, false
+	}
+	g.inFlight[route.InstanceID] = struct{}{}
+
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.inFlight, route.InstanceID)
+	}, true
+}
+
+func writeConcurrencyError(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusUnprocessableEntity)
+	rw.Write([]byte(concurrencyErrorBody))
+}
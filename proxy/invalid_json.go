@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// InvalidJSONError controls what happens to broker error responses labelled
+// as JSON whose body is not JSON, typically an HTML page from a load balancer
+// in front of the broker.
+type InvalidJSONError int
+
+const (
+	// InvalidJSONErrorRewrite replaces the body with an OSB error body.
+	InvalidJSONErrorRewrite InvalidJSONError = iota
+	// InvalidJSONErrorContentType keeps the body and sets a content type
+	// sniffed from it.
+	InvalidJSONErrorContentType
+)
+
+func fixInvalidJSONErrors(policy InvalidJSONError) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if res.StatusCode < http.StatusBadRequest {
+			return nil
+		}
+		if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil || !isJSONMediaType(mediaType) {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if !json.Valid(body) {
+			switch policy {
+			case InvalidJSONErrorRewrite:
+				body, err = json.Marshal(map[string]string{
+					"description": fmt.Sprintf("Broker responded with %d %s and a body that is not JSON", res.StatusCode, http.StatusText(res.StatusCode)),
+				})
+				if err != nil {
+					return err
+				}
+			case InvalidJSONErrorContentType:
+				res.Header.Set("Content-Type", http.DetectContentType(body))
+			}
+		}
+
+		setBody(res, body)
+		return nil
+	}
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// BodyReplacement changes the value at Path in JSON responses to requests
+// whose path matches Endpoint, a path.Match pattern such as
+// /v2/service_instances/*. With Value set, the value is replaced by Value, and
+// a missing last field is added to its object. Otherwise every occurrence of
+// Find in a string value is replaced by Replace, e.g. to swap the host of
+// $.dashboard_url.
+type BodyReplacement struct {
+	Endpoint string          `json:"endpoint"`
+	Path     JSONPath        `json:"path"`
+	Value    json.RawMessage `json:"value"`
+	Find     string          `json:"find"`
+	Replace  string          `json:"replace"`
+}
+
+// JSONPath is a JSONPath expression limited to fields, array indexes and
+// wildcards, such as $.services[*].plans[0].name.
+type JSONPath []jsonPathStep
+
+type jsonPathStep struct {
+	field    string
+	index    int
+	wildcard bool
+}
+
+func ParseJSONPath(expression string) (JSONPath, error) {
+	rest := strings.TrimPrefix(expression, "$")
+	if rest == expression {
+		return nil, fmt.Errorf("JSONPath must start with $: %s", expression)
+	}
+
+	var steps JSONPath
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Unclosed [ in JSONPath: %s", expression)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+
+			if selector == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+				continue
+			}
+			index, err := strconv.Atoi(selector)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("Invalid array index %q in JSONPath: %s", selector, expression)
+			}
+			steps = append(steps, jsonPathStep{index: index})
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			field := rest[:end]
+			rest = rest[end:]
+
+			switch field {
+			case "":
+				return nil, fmt.Errorf("Empty field in JSONPath: %s", expression)
+			case "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			default:
+				steps = append(steps, jsonPathStep{field: field})
+			}
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath: %s", expression)
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("JSONPath must select a field or element: %s", expression)
+	}
+	return steps, nil
+}
+
+func (p *JSONPath) UnmarshalJSON(data []byte) error {
+	var expression string
+	if err := json.Unmarshal(data, &expression); err != nil {
+		return err
+	}
+
+	parsed, err := ParseJSONPath(expression)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// update calls replace with every value p selects in node and stores what it
+// returns, reporting whether anything changed. A field that is missing from
+// its object is passed to replace as nil with exists false.
+func (p JSONPath) update(node interface{}, replace func(value interface{}, exists bool) (interface{}, bool)) bool {
+	step, last := p[0], len(p) == 1
+
+	visit := func(value interface{}, exists bool, set func(interface{})) bool {
+		if !last {
+			return exists && p[1:].update(value, replace)
+		}
+		replaced, changed := replace(value, exists)
+		if changed {
+			set(replaced)
+		}
+		return changed
+	}
+
+	changed := false
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			for field, value := range node {
+				field := field
+				changed = visit(value, true, func(v interface{}) { node[field] = v }) || changed
+			}
+			return changed
+		}
+		if step.field == "" {
+			return false
+		}
+		value, exists := node[step.field]
+		return visit(value, exists, func(v interface{}) { node[step.field] = v })
+	case []interface{}:
+		if step.wildcard {
+			for i, value := range node {
+				i := i
+				changed = visit(value, true, func(v interface{}) { node[i] = v }) || changed
+			}
+			return changed
+		}
+		if step.field != "" || step.index >= len(node) {
+			return false
+		}
+		return visit(node[step.index], true, func(v interface{}) { node[step.index] = v })
+	default:
+		return false
+	}
+}
+
+func (r BodyReplacement) replace(value interface{}, exists bool) (interface{}, bool) {
+	if len(r.Value) != 0 {
+		var replaced interface{}
+		decoder := json.NewDecoder(bytes.NewReader(r.Value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&replaced); err != nil {
+			return nil, false
+		}
+		return replaced, true
+	}
+
+	s, ok := value.(string)
+	if !exists || !ok || r.Find == "" || !strings.Contains(s, r.Find) {
+		return nil, false
+	}
+	return strings.Replace(s, r.Find, r.Replace, -1), true
+}
+
+// replaceJSONPaths applies replacements to JSON response bodies. Bodies that
+// are not JSON, and paths that select nothing, are left untouched.
+func replaceJSONPaths(replacements []BodyReplacement) func(*http.Response) error {
+	return func(res *http.Response) error {
+		var matching []BodyReplacement
+		for _, replacement := range replacements {
+			if ok, _ := path.Match(replacement.Endpoint, res.Request.URL.Path); ok {
+				matching = append(matching, replacement)
+			}
+		}
+		if len(matching) == 0 {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if decoder.Decode(&document) != nil {
+			setBody(res, body)
+			return nil
+		}
+
+		changed := false
+		for _, replacement := range matching {
+			changed = replacement.Path.update(document, replacement.replace) || changed
+		}
+		if changed {
+			if body, err = json.Marshal(document); err != nil {
+				return err
+			}
+		}
+
+		setBody(res, body)
+		return nil
+	}
+}
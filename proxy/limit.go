@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// limitResponseBody rejects broker responses whose Content-Length exceeds
+// max before reading them, and fails the copy of any other body once it
+// crosses max, so an oversized body is never buffered. Event streams are not
+// limited.
+func limitResponseBody(max int64) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if isEventStream(res) {
+			return nil
+		}
+
+		tooLarge := fmt.Errorf("Broker response exceeded the maximum size of %d bytes", max)
+
+		if res.ContentLength > max {
+			res.Body.Close()
+			return tooLarge
+		}
+
+		res.Body = &limitedBody{ReadCloser: res.Body, remaining: max, err: tooLarge}
+		return nil
+	}
+}
+
+// limitedBody passes on at most remaining bytes and fails with err once the
+// body turns out to be longer.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.err
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), b.err
+	}
+	return n, err
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/urfave/negroni"
+)
+
+// MethodOverrideHeader lets clients limited to GET and POST send other
+// methods.
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// MethodOverride turns POST requests carrying X-HTTP-Method-Override into
+// requests with the PUT, PATCH or DELETE method it names, so handlers further
+// down, including ReverseProxy, see the method the client meant. Other
+// methods are rejected with a 400. The header is removed either way, so the
+// broker never sees it.
+func MethodOverride() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		override := r.Header.Get(MethodOverrideHeader)
+		r.Header.Del(MethodOverrideHeader)
+
+		if override != "" && r.Method == http.MethodPost {
+			method := strings.ToUpper(strings.TrimSpace(override))
+			if !overridableMethods[method] {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("Unsupported method override: " + override))
+				return
+			}
+			r.Method = method
+		}
+
+		next(rw, r)
+	})
+}
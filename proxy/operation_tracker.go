@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// operationTracker remembers since when the platform has been polling the
+// last operation of an instance or binding while it stays in progress.
+type operationTracker struct {
+	threshold time.Duration
+	now       func() time.Time
+
+	mu         sync.Mutex
+	operations map[string]*trackedOperation
+}
+
+type trackedOperation struct {
+	firstPoll time.Time
+	lastPoll  time.Time
+	warned    bool
+}
+
+func newOperationTracker(threshold time.Duration, now func() time.Time) *operationTracker {
+	return &operationTracker{threshold: threshold, now: now, operations: map[string]*trackedOperation{}}
+}
+
+// warnStuckOperations logs a warning the first time a last_operation poll
+// finds an operation still in progress more than threshold after the first
+// poll for it. Operations are keyed by instance, binding and the operation
+// query parameter, and forgotten once they succeed, fail or are gone.
+func warnStuckOperations(tracker *operationTracker) func(*http.Response) error {
+	return func(res *http.Response) error {
+		route := osb.Parse(res.Request.Method, res.Request.URL.Path)
+		if route.Operation != osb.LastOperation && route.Operation != osb.BindingLastOperation {
+			return nil
+		}
+
+		key := route.InstanceID + "/" + route.BindingID + "?" + res.Request.URL.Query().Get("operation")
+		if res.StatusCode == http.StatusGone {
+			tracker.forget(key)
+			return nil
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		setBody(res, body)
+
+		var lastOperation struct {
+			State string `json:"state"`
+		}
+		if json.Unmarshal(body, &lastOperation) != nil {
+			return nil
+		}
+
+		switch lastOperation.State {
+		case "in progress":
+			if elapsed, stuck := tracker.poll(key); stuck {
+				log.Printf("Async operation still in progress: method=%s path=%s operation=%s elapsed=%s threshold=%s\n", res.Request.Method, res.Request.URL.Path, res.Request.URL.Query().Get("operation"), elapsed, tracker.threshold)
+			}
+		case "succeeded", "failed":
+			tracker.forget(key)
+		}
+		return nil
+	}
+}
+
+// poll records a poll finding key in progress and reports, once per
+// operation, when it has been in progress longer than the threshold.
+// Operations no longer polled for longer than the threshold are dropped, so
+// ones the platform gave up on do not pile up.
+func (t *operationTracker) poll(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for k, operation := range t.operations {
+		if now.Sub(operation.lastPoll) > t.threshold {
+			delete(t.operations, k)
+		}
+	}
+
+	operation, ok := t.operations[key]
+	if !ok {
+		operation = &trackedOperation{firstPoll: now}
+		t.operations[key] = operation
+	}
+	operation.lastPoll = now
+
+	elapsed := now.Sub(operation.firstPoll)
+	if elapsed <= t.threshold || operation.warned {
+		return elapsed, false
+	}
+	operation.warned = true
+	return elapsed, true
+}
+
+func (t *operationTracker) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.operations, key)
+}
@@ -0,0 +1,90 @@
+package proxy_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Stuck async operations", func() {
+	var (
+		brokerServer *ghttp.Server
+		handler      func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+		clock        *fakeClock
+		logs         *gbytes.Buffer
+		state        string
+	)
+
+	BeforeEach(func() {
+		state = "in progress"
+		brokerServer = ghttp.NewServer()
+		brokerServer.RouteToHandler("GET", "/v2/service_instances/123/last_operation", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"state":"` + state + `"}`))
+		})
+		brokerURL, _ := url.ParseRequestURI(brokerServer.URL())
+
+		clock = &fakeClock{now: time.Now()}
+		handler = proxy.ReverseProxy(brokerURL, proxy.WithClock(clock), proxy.WithStuckOperationWarning(time.Hour))
+
+		logs = gbytes.NewBuffer()
+		log.SetOutput(logs)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+		brokerServer.Close()
+	})
+
+	var poll = func(after time.Duration) string {
+		clock.now = clock.now.Add(after)
+
+		req, _ := http.NewRequest("GET", "/v2/service_instances/123/last_operation?operation=provision", nil)
+		w := httptest.NewRecorder()
+		handler(w, req, func(http.ResponseWriter, *http.Request) {})
+		return w.Body.String()
+	}
+
+	It("warns once when an operation stays in progress beyond the threshold", func() {
+		Expect(poll(0)).To(Equal(`{"state":"in progress"}`))
+		poll(30 * time.Minute)
+		poll(29 * time.Minute)
+		Expect(logs.Contents()).To(BeEmpty())
+
+		poll(2 * time.Minute)
+		Expect(logs).To(gbytes.Say(`Async operation still in progress: method=GET path=/v2/service_instances/123/last_operation operation=provision elapsed=1h1m0s threshold=1h0m0s`))
+
+		poll(time.Minute)
+		Expect(logs.Contents()).NotTo(ContainSubstring("elapsed=1h2m0s"))
+	})
+
+	It("forgets operations that finished", func() {
+		poll(0)
+		poll(50 * time.Minute)
+		state = "succeeded"
+		poll(time.Minute)
+
+		state = "in progress"
+		poll(time.Minute)
+		poll(50 * time.Minute)
+		Expect(logs.Contents()).To(BeEmpty())
+	})
+})
+
+// fakeClock tells whatever time the test sets.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
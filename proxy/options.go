@@ -0,0 +1,527 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/clock"
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+type Option func(*config)
+
+type config struct {
+	transport         http.RoundTripper
+	responseModifiers []func(*http.Response) error
+	transforms        []func(*http.Response) error
+
+	slowRequestThreshold time.Duration
+
+	trailingSlash TrailingSlash
+
+	fallbackBrokers   []*url.URL
+	maxBrokerAttempts int
+
+	retryAsyncRequired bool
+
+	missingAPIVersion MissingAPIVersion
+	defaultAPIVersion string
+
+	requireQueryParams bool
+
+	instanceGuard *instanceGuard
+
+	errorCounter *ErrorCounter
+
+	retryBudget time.Duration
+
+	b3 bool
+
+	correlationID bool
+
+	defaultAccept string
+
+	zeroContentLength bool
+
+	defaultOriginatingIdentity string
+
+	cookies Cookies
+
+	clientCertHeader string
+
+	collapseSlashes bool
+
+	maxRetryAttempts int
+	retryMethods     []string
+	maxRetryAfter    time.Duration
+
+	attemptHeaders  bool
+	requestSequence *uint64
+
+	deadlineHeader string
+
+	maxReplayBodyBytes int64
+	bodyReadTimeout    time.Duration
+
+	maxDecompressedBytes int64
+
+	copyBufferSize int
+
+	clock clock.Clock
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		maxReplayBodyBytes:   DefaultMaxReplayBodyBytes,
+		maxDecompressedBytes: DefaultMaxDecompressedBytes,
+		requestSequence:      new(uint64),
+		clock:                clock.Real,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (c *config) roundTripper(brokerURL *url.URL) http.RoundTripper {
+	transport := c.transport
+	if c.deadlineHeader != "" {
+		transport = &deadlineTransport{next: transport, header: c.deadlineHeader}
+	}
+	if c.attemptHeaders {
+		transport = &attemptTransport{next: transport}
+	}
+	if c.maxRetryAttempts > 1 {
+		retry := newRetryTransport(transport, c.maxRetryAttempts, c.retryMethods)
+		retry.maxRetryAfter = c.maxRetryAfter
+		retry.now = func() time.Time { return c.clock.Now() }
+		transport = retry
+	}
+	if len(c.fallbackBrokers) > 0 {
+		transport = &failoverTransport{next: transport, primary: brokerURL, fallbacks: c.fallbackBrokers, maxAttempts: c.maxBrokerAttempts}
+	}
+	if c.retryAsyncRequired {
+		transport = &asyncRequiredTransport{next: transport}
+	}
+	return transport
+}
+
+// replaysRequests reports whether a request may be sent to the broker more
+// than once, which needs its body buffered.
+func (c *config) replaysRequests() bool {
+	return len(c.fallbackBrokers) > 0 || c.retryAsyncRequired || c.maxRetryAttempts > 1
+}
+
+func (c *config) modifyResponse(res *http.Response) error {
+	stripResponseCookies(res, c.cookies)
+	detectTruncation(res)
+
+	for _, modify := range c.responseModifiers {
+		if err := modify(res); err != nil {
+			return err
+		}
+	}
+
+	if len(c.transforms) == 0 || isEventStream(res) {
+		return nil
+	}
+	return transformDecoded(res, c.transforms, c.maxDecompressedBytes)
+}
+
+// WithMaxResponseBytes caps the size of a broker response body. The client
+// receives a 502 for responses declaring a larger Content-Length, while
+// other responses are cut off once they exceed max.
+func WithMaxResponseBytes(max int64) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, limitResponseBody(max))
+	}
+}
+
+// WithHTTPDoer sends requests to the broker through doer instead of the
+// default transport. A doer that follows redirects will hide them from the
+// client.
+func WithHTTPDoer(doer HTTPDoer) Option {
+	return func(c *config) {
+		c.transport = doerTransport{doer}
+	}
+}
+
+// WithJSONContentType sets Content-Type: application/json on OSB responses
+// whose body is JSON but whose content type is missing or wrong.
+func WithJSONContentType() Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, enforceJSONContentType)
+	}
+}
+
+// WithDashboardURL rewrites dashboard_url in instance responses so dashboards
+// hosted by the broker are reached through externalURL, the address clients
+// use for the proxy.
+func WithDashboardURL(externalURL *url.URL) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, rewriteDashboardURL(externalURL))
+	}
+}
+
+// WithBodyReplacements rewrites values in JSON response bodies as configured
+// by replacements, in order.
+func WithBodyReplacements(replacements ...BodyReplacement) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, replaceJSONPaths(replacements))
+	}
+}
+
+// WithSlowRequestLog logs method, path, status and duration of requests that
+// take longer than threshold to proxy.
+func WithSlowRequestLog(threshold time.Duration) Option {
+	return func(c *config) {
+		c.slowRequestThreshold = threshold
+	}
+}
+
+// WithFallbackBrokers fails over to the given equivalent brokers, in order,
+// when the broker is unreachable or, for GET and DELETE requests, responds
+// with a 5xx. Paths are forwarded below the base path of each fallback.
+// maxAttempts caps the number of brokers tried per request, zero tries each
+// broker once.
+func WithFallbackBrokers(maxAttempts int, fallbacks ...*url.URL) Option {
+	return func(c *config) {
+		c.fallbackBrokers = fallbacks
+		c.maxBrokerAttempts = maxAttempts
+	}
+}
+
+// WithTrailingSlash normalizes trailing slashes on the path forwarded to the
+// broker. By default the path is forwarded as received.
+func WithTrailingSlash(mode TrailingSlash) Option {
+	return func(c *config) {
+		c.trailingSlash = mode
+	}
+}
+
+// WithAsyncRequiredRetry sends a mutating request once more with
+// accepts_incomplete=true when the broker responds with a 422 AsyncRequired
+// error. Without it the 422 is passed on to the platform.
+func WithAsyncRequiredRetry() Option {
+	return func(c *config) {
+		c.retryAsyncRequired = true
+	}
+}
+
+// WithStatusMapping rewrites the status of matching broker responses, for
+// brokers using a different status than the one OSB expects. The first
+// matching mapping wins.
+func WithStatusMapping(mappings ...StatusMapping) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, remapStatus(mappings))
+	}
+}
+
+// WithMissingAPIVersion sets what happens to requests without an
+// X-Broker-API-Version header. defaultVersion is only used by
+// MissingAPIVersionInject. By default such requests are passed through.
+func WithMissingAPIVersion(policy MissingAPIVersion, defaultVersion string) Option {
+	return func(c *config) {
+		c.missingAPIVersion = policy
+		c.defaultAPIVersion = defaultVersion
+	}
+}
+
+// WithDefaultAPIVersion changes the version MissingAPIVersionInject adds
+// without changing the policy, e.g. for a version from a reloaded config.
+func WithDefaultAPIVersion(version string) Option {
+	return func(c *config) {
+		c.defaultAPIVersion = version
+	}
+}
+
+// WithInstanceConcurrencyGuard rejects a mutating request with a 422
+// ConcurrencyError while another one for the same service instance is in
+// flight.
+func WithInstanceConcurrencyGuard() Option {
+	return func(c *config) {
+		c.instanceGuard = newInstanceGuard()
+	}
+}
+
+// WithErrorCounter counts requests the broker could not answer in counter.
+func WithErrorCounter(counter *ErrorCounter) Option {
+	return func(c *config) {
+		c.errorCounter = counter
+	}
+}
+
+// WithRetryBudget bounds the time spent on a request to the broker, including
+// failover and retry attempts, by a single deadline. Each attempt gets what is
+// left of the budget and the client receives a 504 once it is used up.
+func WithRetryBudget(budget time.Duration) Option {
+	return func(c *config) {
+		c.retryBudget = budget
+	}
+}
+
+// WithB3Propagation starts a B3 trace for requests without B3 headers.
+// Requests with them have them forwarded unchanged either way.
+func WithB3Propagation() Option {
+	return func(c *config) {
+		c.b3 = true
+	}
+}
+
+// WithMaxReplayBodyBytes caps the size of request bodies buffered so that
+// fallback brokers or retries can be sent them again. Larger requests are
+// rejected with a 413. Without such features bodies are streamed and not
+// limited.
+func WithMaxReplayBodyBytes(max int64) Option {
+	return func(c *config) {
+		c.maxReplayBodyBytes = max
+	}
+}
+
+// WithBodyReadTimeout reads request bodies in full before contacting the
+// broker and answers clients that take longer than timeout to upload theirs
+// with a 408, closing the connection. Bodies are capped as by
+// WithMaxReplayBodyBytes.
+func WithBodyReadTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.bodyReadTimeout = timeout
+	}
+}
+
+// WithEmptyBodyDefaults substitutes a minimal valid JSON body when the broker
+// responds to one of operations with a 200 and an empty body: an empty
+// services list for the catalog and {} for anything else.
+func WithEmptyBodyDefaults(operations ...osb.Operation) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, defaultEmptyBody(operations))
+	}
+}
+
+// WithLargeResponseWarning logs a warning for broker responses whose body is
+// larger than threshold bytes. Unlike WithMaxResponseBytes the response is
+// still sent to the client.
+func WithLargeResponseWarning(threshold int64) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, warnLargeResponses(threshold))
+	}
+}
+
+// WithContentLengthCheck buffers broker responses to send clients a
+// Content-Length matching the body actually received. policy decides whether
+// a body shorter than its declared length is rejected or forwarded. Without
+// it responses are streamed and a short body aborts the client connection.
+func WithContentLengthCheck(policy ContentLengthMismatch) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, checkContentLength(policy))
+	}
+}
+
+// WithAttemptHeaders numbers the requests sent to the broker with
+// X-Proxy-Request-Sequence, and their failovers and retries with
+// X-Proxy-Attempt starting at 1, so the broker can tell repeated attempts of
+// one request apart from new requests.
+func WithAttemptHeaders() Option {
+	return func(c *config) {
+		c.attemptHeaders = true
+	}
+}
+
+// WithCookies sets whether Cookie and Set-Cookie headers pass through the
+// proxy. By default they are stripped.
+func WithCookies(policy Cookies) Option {
+	return func(c *config) {
+		c.cookies = policy
+	}
+}
+
+// WithRetries sends a request to the same broker again, up to maxAttempts
+// times in total, when the broker cannot be reached. Only requests with one of
+// methods are retried, DefaultRetryMethods when none are given. PUT and PATCH
+// have to be opted in explicitly, as repeating them may duplicate side
+// effects on brokers that are not idempotent. Retries happen before failing
+// over to fallback brokers.
+func WithRetries(maxAttempts int, methods ...string) Option {
+	return func(c *config) {
+		c.maxRetryAttempts = maxAttempts
+		c.retryMethods = methods
+	}
+}
+
+// WithRetryAfter makes WithRetries also retry 429 and 503 responses whose
+// Retry-After asks to wait at most max, after waiting as asked. Responses
+// asking for longer, or for longer than the request has left before its
+// deadline, are returned to the client as they are.
+func WithRetryAfter(max time.Duration) Option {
+	return func(c *config) {
+		c.maxRetryAfter = max
+	}
+}
+
+// WithInvalidJSONErrors fixes up broker error responses whose content type
+// says JSON but whose body is not, as policy says. Other responses are left
+// alone.
+func WithInvalidJSONErrors(policy InvalidJSONError) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, fixInvalidJSONErrors(policy))
+	}
+}
+
+// WithResponseValidation checks successful broker responses for operations,
+// such as provision or last_operation, against the shape the OSB API specifies
+// and handles responses that do not match as validation says.
+func WithResponseValidation(validation ResponseValidation, operations ...osb.Operation) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, validateResponses(validation, operations))
+	}
+}
+
+// WithClientCertForwarding tells the broker about the TLS client certificate
+// of requests in header, ClientCertHeader when empty, in XFCC format. It only
+// applies where the proxy itself terminates TLS.
+func WithClientCertForwarding(header string) Option {
+	return func(c *config) {
+		if header == "" {
+			header = ClientCertHeader
+		}
+		c.clientCertHeader = header
+	}
+}
+
+// WithResponseHeaders adds headers, e.g. Cache-Control: no-store, to the
+// broker responses sent to the client. A header the broker set already is left
+// alone unless override is true.
+func WithResponseHeaders(headers map[string]string, override bool) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, injectResponseHeaders(headers, override))
+	}
+}
+
+// WithErrorDescriptionRedaction redacts the parts of OSB error descriptions
+// matching any of patterns, such as stack traces or internal hostnames, before
+// they reach the platform.
+func WithErrorDescriptionRedaction(patterns ...*regexp.Regexp) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, sanitizeErrorDescriptions(patterns))
+	}
+}
+
+// WithCollapsedSlashes forwards paths with runs of slashes collapsed into
+// one, for brokers that reject paths like /v2//catalog. By default paths are
+// forwarded as received.
+func WithCollapsedSlashes() Option {
+	return func(c *config) {
+		c.collapseSlashes = true
+	}
+}
+
+// WithClock makes the proxy read the time from c, so tests control how long
+// async operations appear to take.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithStuckOperationWarning logs a warning when the platform is still polling
+// an async operation that has been in progress for more than threshold since
+// its first last_operation poll. Responses are not changed.
+func WithStuckOperationWarning(threshold time.Duration) Option {
+	return func(c *config) {
+		tracker := newOperationTracker(threshold, func() time.Time { return c.clock.Now() })
+		c.transforms = append(c.transforms, warnStuckOperations(tracker))
+	}
+}
+
+// WithCorrelationID makes sure every request to the broker carries an
+// X-Correlation-Id, generating one when the client sent none, and returns it
+// to the client. It is independent of WithB3Propagation.
+func WithCorrelationID() Option {
+	return func(c *config) {
+		c.correlationID = true
+		c.responseModifiers = append(c.responseModifiers, dropBrokerCorrelationID)
+	}
+}
+
+// WithMaxDecompressedBytes caps the size compressed broker responses may
+// expand to when they are decompressed for transforms, instead of
+// DefaultMaxDecompressedBytes. Larger responses get a 502.
+func WithMaxDecompressedBytes(max int64) Option {
+	return func(c *config) {
+		c.maxDecompressedBytes = max
+	}
+}
+
+// WithDeadlineHeader tells the broker in header, DeadlineHeader when empty,
+// how much time remains before the proxy abandons the request, for requests
+// with a deadline such as the one WithRetryBudget sets. With
+// GRPCTimeoutHeader the value is in the gRPC format instead of plain
+// milliseconds.
+func WithDeadlineHeader(header string) Option {
+	return func(c *config) {
+		if header == "" {
+			header = DeadlineHeader
+		}
+		c.deadlineHeader = header
+	}
+}
+
+// WithDefaultOriginatingIdentity sends header, e.g. from
+// osb.OriginatingIdentity.Encode, as the X-Broker-API-Originating-Identity of
+// requests without one, for brokers requiring it. An identity sent by the
+// client is forwarded as it is.
+func WithDefaultOriginatingIdentity(header string) Option {
+	return func(c *config) {
+		c.defaultOriginatingIdentity = header
+	}
+}
+
+// WithDefaultAccept sends Accept: accept, application/json when empty, to the
+// broker on requests without an Accept header, for brokers that answer those
+// with a 406. An Accept header sent by the client is forwarded as it is.
+func WithDefaultAccept(accept string) Option {
+	return func(c *config) {
+		if accept == "" {
+			accept = "application/json"
+		}
+		c.defaultAccept = accept
+	}
+}
+
+// WithCopyBufferSize copies response bodies to the client through buffers of
+// size bytes instead of DefaultCopyBufferSize. Larger buffers need fewer
+// writes for big responses at the cost of memory per concurrent response.
+func WithCopyBufferSize(size int) Option {
+	return func(c *config) {
+		c.copyBufferSize = size
+	}
+}
+
+// WithClockSkewWarning logs a warning when the Date header of broker
+// responses is more than threshold ahead of or behind the proxy's clock, which
+// breaks token expiry and caching. Responses are not changed.
+func WithClockSkewWarning(threshold time.Duration) Option {
+	return func(c *config) {
+		c.responseModifiers = append(c.responseModifiers, warnClockSkew(threshold, func() time.Time { return c.clock.Now() }))
+	}
+}
+
+// WithRequiredQueryParams responds with a 400 to requests fetching an
+// instance, a binding or their last operation without the service_id and
+// plan_id query parameters, instead of forwarding them to a broker that
+// needs them.
+func WithRequiredQueryParams() Option {
+	return func(c *config) {
+		c.requireQueryParams = true
+	}
+}
+
+// WithZeroContentLength sends Content-Length: 0 on bodyless requests to the
+// broker other than GET and HEAD, such as deprovisions, for brokers that
+// reject them without it.
+func WithZeroContentLength() Option {
+	return func(c *config) {
+		c.zeroContentLength = true
+	}
+}
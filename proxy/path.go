@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TrailingSlash controls how trailing slashes on forwarded paths are treated.
+type TrailingSlash int
+
+const (
+	// TrailingSlashExact forwards the path as received.
+	TrailingSlashExact TrailingSlash = iota
+	// TrailingSlashStrip removes trailing slashes, e.g. /v2/catalog/ becomes
+	// /v2/catalog.
+	TrailingSlashStrip
+	// TrailingSlashKeep makes sure the path ends in a single slash, e.g.
+	// /v2/catalog becomes /v2/catalog/.
+	TrailingSlashKeep
+)
+
+func normalizeTrailingSlash(req *http.Request, mode TrailingSlash) {
+	switch mode {
+	case TrailingSlashStrip:
+		req.URL.Path = stripTrailingSlash(req.URL.Path)
+		req.URL.RawPath = stripTrailingSlash(req.URL.RawPath)
+	case TrailingSlashKeep:
+		req.URL.Path = keepTrailingSlash(req.URL.Path)
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = keepTrailingSlash(req.URL.RawPath)
+		}
+	}
+}
+
+func stripTrailingSlash(path string) string {
+	trimmed := strings.TrimRight(path, "/")
+	if trimmed == "" && path != "" {
+		return "/"
+	}
+	return trimmed
+}
+
+func keepTrailingSlash(path string) string {
+	return strings.TrimRight(path, "/") + "/"
+}
+
+// collapseSlashes replaces runs of slashes in the path with a single one, e.g.
+// /v2//catalog becomes /v2/catalog. Encoded slashes (%2F) are part of a
+// segment and left alone, as is the query.
+func collapseSlashes(req *http.Request) {
+	if req.URL.RawPath == "" {
+		req.URL.Path = collapse(req.URL.Path)
+		return
+	}
+
+	rawPath := collapse(req.URL.RawPath)
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return
+	}
+	req.URL.Path, req.URL.RawPath = path, rawPath
+}
+
+func collapse(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.Replace(path, "//", "/", -1)
+	}
+	return path
+}
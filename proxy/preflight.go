@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+var (
+	osbMethods = []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	corsAllowedHeaders = strings.Join([]string{
+		"Authorization",
+		"Content-Type",
+		osb.APIVersionHeader,
+		osb.OriginatingIdentityHeader,
+		CorrelationIDHeader,
+	}, ", ")
+)
+
+// Preflight answers OPTIONS requests itself with the methods the endpoint
+// accepts in Allow, and rejects TRACE with a 405 so it cannot be used for
+// cross-site tracing. Neither reaches the broker. Requests whose Origin is in
+// allowedOrigins, or any origin when it holds "*", get CORS headers allowing
+// them; without allowedOrigins none are sent.
+func Preflight(allowedOrigins []string) negroni.HandlerFunc {
+	origins := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		origins[origin] = true
+	}
+
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		allow := allowedMethods(r.URL.Path)
+
+		if origin := r.Header.Get("Origin"); origin != "" && (origins[origin] || origins["*"]) {
+			rw.Header().Add("Vary", "Origin")
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions {
+				rw.Header().Set("Access-Control-Allow-Methods", allow)
+				rw.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			}
+		}
+
+		switch r.Method {
+		case http.MethodOptions:
+			rw.Header().Set("Allow", allow)
+			rw.WriteHeader(http.StatusNoContent)
+		case http.MethodTrace:
+			rw.Header().Set("Allow", allow)
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			rw.Write([]byte("TRACE is not allowed"))
+		default:
+			next(rw, r)
+		}
+	})
+}
+
+// allowedMethods lists the methods of the OSB endpoint at path, or every
+// method for paths outside OSB, which the broker may serve too.
+func allowedMethods(path string) string {
+	var methods []string
+	for _, method := range osbMethods {
+		if osb.Parse(method, path).Operation != osb.Unknown {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		methods = append([]string{http.MethodPost}, osbMethods...)
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
@@ -0,0 +1,88 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Preflight", func() {
+	var (
+		req    *http.Request
+		called bool
+	)
+
+	BeforeEach(func() {
+		called = false
+	})
+
+	var serve = func(allowedOrigins ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		proxy.Preflight(allowedOrigins)(w, req, func(http.ResponseWriter, *http.Request) {
+			called = true
+		})
+		return w
+	}
+
+	It("answers OPTIONS with the methods of the endpoint", func() {
+		req = httptest.NewRequest("OPTIONS", "/v2/service_instances/123", nil)
+
+		w := serve()
+
+		Expect(called).To(BeFalse())
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("Allow")).To(Equal("GET, PUT, PATCH, DELETE, OPTIONS"))
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	It("answers a CORS preflight from an allowed origin", func() {
+		req = httptest.NewRequest("OPTIONS", "/v2/catalog", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+
+		w := serve("https://dashboard.example.com")
+
+		Expect(called).To(BeFalse())
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("Allow")).To(Equal("GET, OPTIONS"))
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+		Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, OPTIONS"))
+		Expect(w.Header().Get("Access-Control-Allow-Headers")).To(ContainSubstring("X-Broker-API-Version"))
+		Expect(w.Header().Get("Vary")).To(Equal("Origin"))
+	})
+
+	It("sends no CORS headers to other origins", func() {
+		req = httptest.NewRequest("OPTIONS", "/v2/catalog", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+
+		w := serve("https://dashboard.example.com")
+
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	It("rejects TRACE", func() {
+		req = httptest.NewRequest("TRACE", "/v2/catalog", nil)
+
+		w := serve()
+
+		Expect(called).To(BeFalse())
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(w.Header().Get("Allow")).To(Equal("GET, OPTIONS"))
+	})
+
+	It("passes other requests on with CORS headers for allowed origins", func() {
+		req = httptest.NewRequest("GET", "/v2/catalog", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+
+		w := serve("*")
+
+		Expect(called).To(BeTrue())
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+		Expect(w.Header().Get("Access-Control-Allow-Methods")).To(BeEmpty())
+	})
+})
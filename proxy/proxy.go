@@ -1,26 +1,141 @@
 package proxy
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sync/atomic"
 
 	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/logging"
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
 )
 
-func ReverseProxy(brokerURL *url.URL) negroni.HandlerFunc {
+var sharedBufferPool = newBufferPool(DefaultCopyBufferSize)
+
+func ReverseProxy(brokerURL *url.URL, opts ...Option) negroni.HandlerFunc {
+	return reverseProxy(brokerURL, newConfig(opts))
+}
+
+func reverseProxy(brokerURL *url.URL, cfg *config) negroni.HandlerFunc {
 	reverseProxy := httputil.NewSingleHostReverseProxy(brokerURL)
 	dirFunc := reverseProxy.Director
 
 	newDirFunc := func(req *http.Request) {
 		dirFunc(req)
 		req.Host = brokerURL.Host
+		if cfg.collapseSlashes {
+			collapseSlashes(req)
+		}
+		normalizeTrailingSlash(req, cfg.trailingSlash)
+		stripRequestCookies(req, cfg.cookies)
+		if cfg.clientCertHeader != "" {
+			forwardClientCert(req, cfg.clientCertHeader)
+		}
+		if cfg.b3 {
+			ensureB3(req)
+		}
+		if cfg.defaultAccept != "" && req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", cfg.defaultAccept)
+		}
+		if cfg.zeroContentLength {
+			sendZeroContentLength(req)
+		}
+		if cfg.defaultOriginatingIdentity != "" && req.Header.Get(osb.OriginatingIdentityHeader) == "" {
+			req.Header.Set(osb.OriginatingIdentityHeader, cfg.defaultOriginatingIdentity)
+		}
 	}
 
 	reverseProxy.Director = newDirFunc
+	reverseProxy.Transport = cfg.roundTripper(brokerURL)
+	reverseProxy.BufferPool = sharedBufferPool
+	if cfg.copyBufferSize > 0 && cfg.copyBufferSize != DefaultCopyBufferSize {
+		reverseProxy.BufferPool = newBufferPool(cfg.copyBufferSize)
+	}
+	reverseProxy.ModifyResponse = cfg.modifyResponse
+	reverseProxy.ErrorHandler = errorHandler
+	if cfg.errorCounter != nil {
+		reverseProxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
+			cfg.errorCounter.count(classify(r, err))
+			errorHandler(rw, r, err)
+		}
+	}
 
 	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		reverseProxy.ServeHTTP(rw, r)
+		if !checkAPIVersion(rw, r, cfg.missingAPIVersion, cfg.defaultAPIVersion) {
+			return
+		}
+
+		if cfg.requireQueryParams && !checkQueryParams(rw, r) {
+			return
+		}
+
+		if cfg.correlationID {
+			ensureCorrelationID(rw, r)
+		}
+
+		if cfg.replaysRequests() || cfg.bodyReadTimeout > 0 {
+			if err := bufferBody(r, cfg.maxReplayBodyBytes, cfg.bodyReadTimeout); err != nil {
+				writeBodyError(rw, r, err, cfg.bodyReadTimeout)
+				return
+			}
+		}
+
+		if cfg.retryBudget > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), cfg.retryBudget)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		if cfg.attemptHeaders {
+			r = r.WithContext(withAttempts(r.Context(), atomic.AddUint64(cfg.requestSequence, 1)))
+		}
+
+		if cfg.instanceGuard != nil {
+			release, ok := cfg.instanceGuard.acquire(r)
+			if !ok {
+				writeConcurrencyError(rw)
+				return
+			}
+			defer release()
+		}
+
+		if cfg.slowRequestThreshold > 0 {
+			logSlowRequests(cfg.slowRequestThreshold, reverseProxy, rw, r)
+		} else {
+			reverseProxy.ServeHTTP(rw, r)
+		}
 		next(rw, r)
 	})
 }
+
+func errorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	switch classify(r, err) {
+	case errorCanceled:
+		// The client is gone, there is no one to respond to.
+		logging.Debugf("Client canceled request %s %s\n", r.Method, r.URL.Path)
+	case errorTimeout:
+		msg := redact.Secrets(fmt.Sprintf("Timed out waiting for the broker: %s", err.Error()), r.Header)
+		log.Println(msg)
+
+		rw.WriteHeader(http.StatusGatewayTimeout)
+		rw.Write([]byte(msg))
+	case errorRateLimited:
+		msg := redact.Secrets(fmt.Sprintf("Error proxying request to broker: %s", err.Error()), r.Header)
+		log.Println(msg)
+
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte(msg))
+	default:
+		msg := redact.Secrets(fmt.Sprintf("Error proxying request to broker: %s", err.Error()), r.Header)
+		log.Println(msg)
+
+		rw.WriteHeader(http.StatusBadGateway)
+		rw.Write([]byte(msg))
+	}
+}
@@ -0,0 +1,56 @@
+package proxy_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+)
+
+type staticDoer struct {
+	body []byte
+}
+
+func (d staticDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(d.body)),
+		ContentLength: int64(len(d.body)),
+		Request:       req,
+	}, nil
+}
+
+func BenchmarkReverseProxy(b *testing.B) {
+	benchmarkReverseProxy(b, 4096)
+}
+
+func BenchmarkReverseProxyCopyBufferSize(b *testing.B) {
+	for _, size := range []int{4 << 10, 32 << 10, 256 << 10} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			benchmarkReverseProxy(b, 1<<20, proxy.WithCopyBufferSize(size))
+		})
+	}
+}
+
+func benchmarkReverseProxy(b *testing.B, bodySize int, opts ...proxy.Option) {
+	brokerURL, _ := url.Parse("http://broker.example.com")
+	opts = append([]proxy.Option{proxy.WithHTTPDoer(staticDoer{body: bytes.Repeat([]byte("a"), bodySize)})}, opts...)
+	handler := proxy.ReverseProxy(brokerURL, opts...)
+	next := func(w http.ResponseWriter, r *http.Request) {}
+
+	req := httptest.NewRequest("GET", "/v2/catalog", nil)
+	req.Header.Set("Authorization", "Bearer some-token")
+	req.Header.Set("X-Broker-API-Version", "2.14")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(httptest.NewRecorder(), req, next)
+	}
+}
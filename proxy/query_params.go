@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// requiredQueryParams lists the query parameters platforms send on the GET
+// endpoints that some brokers cannot do without.
+var requiredQueryParams = map[osb.Operation][]string{
+	osb.GetInstance:          {"service_id", "plan_id"},
+	osb.LastOperation:        {"service_id", "plan_id"},
+	osb.GetBinding:           {"service_id", "plan_id"},
+	osb.BindingLastOperation: {"service_id", "plan_id"},
+}
+
+// checkQueryParams responds with a 400 and reports false when r lacks one of
+// the query parameters required for its endpoint.
+func checkQueryParams(rw http.ResponseWriter, r *http.Request) bool {
+	query := r.URL.Query()
+
+	var missing []string
+	for _, param := range requiredQueryParams[osb.Parse(r.Method, r.URL.Path).Operation] {
+		if query.Get(param) == "" {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) == 0 {
+		return true
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"description": "Missing required query parameters: " + strings.Join(missing, ", "),
+	})
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusBadRequest)
+	rw.Write(body)
+	return false
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+const panicErrorBody = `{"error":"InternalServerError","description":"The proxy failed to handle the request."}`
+
+// Recover turns a panic further down the chain into a 500 with an OSB error
+// body, logging the stack trace rather than sending it to the client, and
+// counts it in counter as a panic when counter is not nil. When the response
+// has already started the connection is dropped instead.
+func Recover(counter *ErrorCounter) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		defer func() {
+			recovered := recover()
+			switch recovered {
+			case nil:
+				return
+			case http.ErrAbortHandler:
+				// ReverseProxy aborts on purpose when copying the response
+				// fails; let net/http close the connection quietly.
+				panic(recovered)
+			}
+
+			msg := redact.Secrets(fmt.Sprintf("Panic serving %s %s: %v", r.Method, r.URL.Path, recovered), r.Header)
+			log.Printf("%s\n%s", msg, debug.Stack())
+			if counter != nil {
+				counter.count(errorPanic)
+			}
+
+			if written, ok := rw.(negroni.ResponseWriter); ok && written.Written() {
+				panic(http.ErrAbortHandler)
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(panicErrorBody))
+		}()
+
+		next(rw, r)
+	})
+}
@@ -0,0 +1,81 @@
+package proxy_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/urfave/negroni"
+)
+
+type panickingDoer struct{}
+
+func (panickingDoer) Do(req *http.Request) (*http.Response, error) {
+	panic("hook exploded")
+}
+
+var _ = Describe("Recover", func() {
+	var logs *gbytes.Buffer
+
+	BeforeEach(func() {
+		logs = gbytes.NewBuffer()
+		log.SetOutput(logs)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	It("responds with a 500 and logs the stack when the proxy panics", func() {
+		brokerURL, _ := url.Parse("http://broker.example.com")
+		counter := proxy.NewErrorCounter()
+		n := negroni.New(proxy.Recover(counter), proxy.ReverseProxy(brokerURL, proxy.WithHTTPDoer(panickingDoer{})))
+
+		req := httptest.NewRequest("GET", "/v2/catalog", nil)
+		req.Header.Set("X-Broker-API-Version", "2.14")
+		rec := httptest.NewRecorder()
+		Expect(func() { n.ServeHTTP(rec, req) }).NotTo(Panic())
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(rec.Body.String()).To(MatchJSON(`{"error":"InternalServerError","description":"The proxy failed to handle the request."}`))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("hook exploded"))
+
+		Expect(logs).To(gbytes.Say("Panic serving GET /v2/catalog: hook exploded"))
+		Expect(logs).To(gbytes.Say(`goroutine \d+`))
+		Expect(counter.Counts()).To(HaveKeyWithValue("panic", uint64(1)))
+	})
+
+	It("drops the connection when the response has already started", func() {
+		n := negroni.New(proxy.Recover(nil), negroni.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("too late")
+		}))
+
+		Expect(panicOf(func() { n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/catalog", nil)) })).To(Equal(http.ErrAbortHandler))
+	})
+
+	It("lets aborted handlers abort", func() {
+		n := negroni.New(proxy.Recover(nil), negroni.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		Expect(panicOf(func() { n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/catalog", nil)) })).To(Equal(http.ErrAbortHandler))
+		Expect(logs.Contents()).To(BeEmpty())
+	})
+})
+
+func panicOf(f func()) (recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	f()
+	return nil
+}
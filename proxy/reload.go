@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/urfave/negroni"
+)
+
+// Reloadable is a ReverseProxy whose options can be changed while it serves
+// requests. The instance concurrency guard and the request sequence are kept
+// across reloads, so operations in flight stay guarded and sequence numbers
+// are not reused.
+type Reloadable struct {
+	brokerURL *url.URL
+	opts      []Option
+	guard     *instanceGuard
+	sequence  *uint64
+	current   atomic.Value
+}
+
+// NewReloadable builds a Reloadable serving requests with opts until the
+// first Reload.
+func NewReloadable(brokerURL *url.URL, opts ...Option) *Reloadable {
+	cfg := newConfig(opts)
+	p := &Reloadable{brokerURL: brokerURL, opts: opts, guard: cfg.instanceGuard, sequence: cfg.requestSequence}
+	p.current.Store(reverseProxy(brokerURL, cfg))
+	return p
+}
+
+// Reload serves subsequent requests with the options given to NewReloadable
+// followed by opts. Requests already in flight finish with the old options.
+func (p *Reloadable) Reload(opts ...Option) {
+	cfg := newConfig(append(p.opts[:len(p.opts):len(p.opts)], opts...))
+	cfg.instanceGuard, cfg.requestSequence = p.guard, p.sequence
+	p.current.Store(reverseProxy(p.brokerURL, cfg))
+}
+
+func (p *Reloadable) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	p.current.Load().(negroni.HandlerFunc)(rw, r, next)
+}
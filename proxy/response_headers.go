@@ -0,0 +1,17 @@
+package proxy
+
+import "net/http"
+
+// injectResponseHeaders adds headers to broker responses. Headers the broker
+// set itself are kept unless override is true.
+func injectResponseHeaders(headers map[string]string, override bool) func(*http.Response) error {
+	return func(res *http.Response) error {
+		for name, value := range headers {
+			if !override && res.Header.Get(name) != "" {
+				continue
+			}
+			res.Header.Set(name, value)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// ResponseValidation decides what happens to successful broker responses
+// whose body does not have the shape the OSB API specifies for the endpoint.
+type ResponseValidation int
+
+const (
+	// ResponseValidationLog logs the response and forwards it as it is.
+	ResponseValidationLog ResponseValidation = iota
+	// ResponseValidationReject logs the response and replaces it with a 502,
+	// so the platform does not record state the broker never meant.
+	ResponseValidationReject
+)
+
+// responseSchemas checks the body of 2xx responses per operation. Fields the
+// OSB API makes optional are only checked when present.
+var responseSchemas = map[osb.Operation]func(status int, fields map[string]json.RawMessage) error{
+	osb.Provision:            instanceResponseSchema,
+	osb.Update:               instanceResponseSchema,
+	osb.Deprovision:          asyncResponseSchema,
+	osb.Bind:                 bindingResponseSchema,
+	osb.Unbind:               asyncResponseSchema,
+	osb.LastOperation:        lastOperationResponseSchema,
+	osb.BindingLastOperation: lastOperationResponseSchema,
+}
+
+func instanceResponseSchema(status int, fields map[string]json.RawMessage) error {
+	if err := asyncResponseSchema(status, fields); err != nil {
+		return err
+	}
+	if err := optionalField(fields, "dashboard_url", new(string)); err != nil {
+		return err
+	}
+	return optionalField(fields, "metadata", new(map[string]json.RawMessage))
+}
+
+func bindingResponseSchema(status int, fields map[string]json.RawMessage) error {
+	if err := asyncResponseSchema(status, fields); err != nil {
+		return err
+	}
+	if err := optionalField(fields, "credentials", new(map[string]json.RawMessage)); err != nil {
+		return err
+	}
+	if err := optionalField(fields, "syslog_drain_url", new(string)); err != nil {
+		return err
+	}
+	return optionalField(fields, "route_service_url", new(string))
+}
+
+func asyncResponseSchema(status int, fields map[string]json.RawMessage) error {
+	return optionalField(fields, "operation", new(string))
+}
+
+func lastOperationResponseSchema(status int, fields map[string]json.RawMessage) error {
+	if status != http.StatusOK {
+		return nil
+	}
+
+	var state string
+	if _, ok := fields["state"]; !ok {
+		return errors.New("missing state")
+	}
+	if err := json.Unmarshal(fields["state"], &state); err != nil {
+		return errors.New("state must be a string")
+	}
+	switch state {
+	case "in progress", "succeeded", "failed":
+	default:
+		return fmt.Errorf("invalid state %q", state)
+	}
+
+	return optionalField(fields, "description", new(string))
+}
+
+func optionalField(fields map[string]json.RawMessage, name string, value interface{}) error {
+	raw, ok := fields[name]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return fmt.Errorf("%s has the wrong type", name)
+	}
+	return nil
+}
+
+// validateResponses checks successful responses for operations against
+// responseSchemas, acting on mismatches as validation says.
+func validateResponses(validation ResponseValidation, operations []osb.Operation) func(*http.Response) error {
+	enabled := map[osb.Operation]bool{}
+	for _, operation := range operations {
+		enabled[operation] = true
+	}
+
+	return func(res *http.Response) error {
+		operation := osb.Parse(res.Request.Method, res.Request.URL.Path).Operation
+		schema, ok := responseSchemas[operation]
+		if !ok || !enabled[operation] || res.StatusCode < 200 || res.StatusCode > 299 {
+			return nil
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil || fields == nil {
+			err = errors.New("body is not a JSON object")
+		} else {
+			err = schema(res.StatusCode, fields)
+		}
+		if err == nil {
+			setBody(res, body)
+			return nil
+		}
+
+		log.Printf("Broker response does not match the OSB API: operation=%s path=%s status=%d error=%q", operation, res.Request.URL.Path, res.StatusCode, err)
+		if validation != ResponseValidationReject {
+			setBody(res, body)
+			return nil
+		}
+
+		if body, err = json.Marshal(map[string]string{
+			"description": fmt.Sprintf("Broker sent an invalid %s response: %s", operation, err),
+		}); err != nil {
+			return err
+		}
+		res.StatusCode = http.StatusBadGateway
+		res.Status = fmt.Sprintf("%d %s", http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+		res.Header.Set("Content-Type", "application/json")
+		setBody(res, body)
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+)
+
+// warnLargeResponses wraps the broker response body to count the bytes read
+// from it while it is streamed to the client, and logs a warning once the
+// body is closed if it exceeded threshold. The response is never blocked.
+func warnLargeResponses(threshold int64) func(*http.Response) error {
+	return func(res *http.Response) error {
+		res.Body = &countingBody{
+			ReadCloser: res.Body,
+			done: func(n int64) {
+				if n > threshold {
+					log.Printf("Large broker response: method=%s path=%s status=%d bytes=%d threshold=%d\n", res.Request.Method, res.Request.URL.Path, res.StatusCode, n, threshold)
+				}
+			},
+		}
+		return nil
+	}
+}
+
+// countingBody counts the bytes read through it and reports the total to done
+// on the first Close.
+type countingBody struct {
+	io.ReadCloser
+	n      int64
+	done   func(int64)
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		b.done(b.n)
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// DefaultRetryMethods are retried by WithRetries unless other methods are
+// given. Both are idempotent, so a request that reached the broker before the
+// connection failed has no extra side effect when sent again.
+var DefaultRetryMethods = []string{http.MethodGet, http.MethodDelete}
+
+// retryTransport sends a request again when the broker could not be reached,
+// for the methods it was told are safe to repeat. With maxRetryAfter set it
+// also retries 429 and 503 responses carrying a Retry-After of at most
+// maxRetryAfter, once that time has passed.
+type retryTransport struct {
+	next          http.RoundTripper
+	maxAttempts   int
+	methods       map[string]bool
+	maxRetryAfter time.Duration
+	now           func() time.Time
+}
+
+func newRetryTransport(next http.RoundTripper, maxAttempts int, methods []string) *retryTransport {
+	if len(methods) == 0 {
+		methods = DefaultRetryMethods
+	}
+	t := &retryTransport{next: next, maxAttempts: maxAttempts, methods: map[string]bool{}, now: time.Now}
+	for _, method := range methods {
+		t.methods[method] = true
+	}
+	return t
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if !t.methods[req.Method] {
+		return next.RoundTrip(req)
+	}
+
+	body, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		try := req.Clone(req.Context())
+		if body != nil {
+			try.Body, _ = body()
+		}
+
+		res, err := next.RoundTrip(try)
+		if attempt >= t.maxAttempts {
+			return res, err
+		}
+
+		if err == nil {
+			wait, ok := t.retryAfter(req, res)
+			if !ok {
+				return res, nil
+			}
+
+			log.Printf("Broker %s responded with %d, retrying %s %s after %s\n", req.URL.Host, res.StatusCode, req.Method, req.URL.Path, wait)
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+			continue
+		}
+
+		if classify(req, err) != errorUnreachable {
+			return nil, err
+		}
+
+		log.Printf("Broker %s unreachable, retrying %s %s: %s\n", req.URL.Host, req.Method, req.URL.Path, redact.Error(err, req.Header))
+	}
+}
+
+// retryAfter reports how long to wait before retrying res, and whether to
+// retry it at all: only 429 and 503 responses whose Retry-After, in seconds or
+// as an HTTP date, is within maxRetryAfter and ends before the request's
+// deadline.
+func (t *retryTransport) retryAfter(req *http.Request, res *http.Response) (time.Duration, bool) {
+	if t.maxRetryAfter <= 0 || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	header := strings.TrimSpace(res.Header.Get("Retry-After"))
+	var wait time.Duration
+	if seconds, err := strconv.ParseInt(header, 10, 64); err == nil && seconds >= 0 {
+		// Checked before converting, as large values overflow a Duration.
+		if seconds > int64(t.maxRetryAfter/time.Second) {
+			return 0, false
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = date.Sub(t.now())
+		if wait < 0 {
+			wait = 0
+		}
+	} else {
+		return 0, false
+	}
+
+	if wait > t.maxRetryAfter {
+		return 0, false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) <= wait {
+		return 0, false
+	}
+	return wait, true
+}
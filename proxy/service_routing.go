@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// BrokerRoute sends requests for the given services and plans to Handler.
+type BrokerRoute struct {
+	ServiceIDs []string
+	PlanIDs    []string
+	Handler    http.Handler
+}
+
+// ByService hands each request to the handler of the route matching its
+// plan_id or, failing that, its service_id, taken from the body of PUT and
+// PATCH requests and from the query of others. Requests with ids no route
+// matches go to fallback. Requests for an instance or binding without either
+// id are rejected with a 400, as there is no telling which broker owns it.
+// Catalog requests are sent to fallback and every route, and the services of
+// their catalogs merged in that order. Bodies are read within the
+// WithMaxReplayBodyBytes and WithBodyReadTimeout options.
+func ByService(routes []BrokerRoute, fallback http.Handler, opts ...Option) negroni.HandlerFunc {
+	cfg := newConfig(opts)
+	services, plans := map[string]http.Handler{}, map[string]http.Handler{}
+	handlers := []http.Handler{fallback}
+	for _, route := range routes {
+		for _, id := range route.ServiceIDs {
+			services[id] = route.Handler
+		}
+		for _, id := range route.PlanIDs {
+			plans[id] = route.Handler
+		}
+		handlers = append(handlers, route.Handler)
+	}
+
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		route := osb.Parse(r.Method, r.URL.Path)
+		if route.Operation == osb.Catalog {
+			mergeCatalogs(rw, r, handlers)
+			next(rw, r)
+			return
+		}
+
+		serviceID, planID, err := serviceAndPlan(r, cfg)
+		if err != nil {
+			writeBodyError(rw, r, err, cfg.bodyReadTimeout)
+			return
+		}
+
+		handler, ok := plans[planID]
+		if !ok {
+			handler, ok = services[serviceID]
+		}
+		if !ok {
+			if route.InstanceID != "" && serviceID == "" && planID == "" {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("service_id or plan_id is required to route requests for service instances"))
+				return
+			}
+			handler = fallback
+		}
+
+		handler.ServeHTTP(rw, r)
+		next(rw, r)
+	})
+}
+
+// serviceAndPlan reads the service and plan ids of r, buffering its body.
+func serviceAndPlan(r *http.Request, cfg *config) (string, string, error) {
+	if (r.Method != http.MethodPut && r.Method != http.MethodPatch) || r.Body == nil {
+		return r.URL.Query().Get("service_id"), r.URL.Query().Get("plan_id"), nil
+	}
+
+	if err := bufferBody(r, cfg.maxReplayBodyBytes, cfg.bodyReadTimeout); err != nil {
+		return "", "", err
+	}
+	if r.GetBody == nil {
+		return "", "", nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return "", "", err
+	}
+
+	var ids struct {
+		ServiceID string `json:"service_id"`
+		PlanID    string `json:"plan_id"`
+	}
+	json.NewDecoder(body).Decode(&ids)
+	return ids.ServiceID, ids.PlanID, nil
+}
+
+// mergeCatalogs responds with the services of the catalogs served by
+// handlers. When a handler fails, its response is sent instead.
+func mergeCatalogs(rw http.ResponseWriter, r *http.Request, handlers []http.Handler) {
+	var header http.Header
+	merged := []json.RawMessage{}
+	seen := map[string]bool{}
+
+	for _, handler := range handlers {
+		req := r.Clone(r.Context())
+		// Catalogs are decoded to be merged.
+		req.Header.Del("Accept-Encoding")
+
+		buf := &catalogBuffer{header: http.Header{}, status: http.StatusOK}
+		handler.ServeHTTP(buf, req)
+
+		var catalog struct {
+			Services []json.RawMessage `json:"services"`
+		}
+		if buf.status != http.StatusOK || json.Unmarshal(buf.body.Bytes(), &catalog) != nil {
+			buf.writeTo(rw)
+			return
+		}
+
+		if header == nil {
+			header = buf.header
+		}
+		for _, service := range catalog.Services {
+			var ids struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(service, &ids)
+			if seen[ids.ID] {
+				log.Printf("Service %s is offered by more than one broker, keeping the first\n", ids.ID)
+				continue
+			}
+			seen[ids.ID] = true
+			merged = append(merged, service)
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"services": merged})
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte("Error encoding merged catalog"))
+		return
+	}
+
+	for name, values := range header {
+		rw.Header()[name] = values
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(body)
+}
+
+// catalogBuffer holds the catalog of one broker until all are merged.
+type catalogBuffer struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *catalogBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *catalogBuffer) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status, b.wroteHeader = status, true
+	}
+}
+
+func (b *catalogBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *catalogBuffer) writeTo(rw http.ResponseWriter) {
+	for name, values := range b.header {
+		rw.Header()[name] = values
+	}
+	rw.WriteHeader(b.status)
+	rw.Write(b.body.Bytes())
+}
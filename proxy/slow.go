@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusRecorder remembers the status code written to the client.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logSlowRequests serves r through handler and logs a warning when it takes
+// longer than threshold.
+func logSlowRequests(threshold time.Duration, handler http.Handler, rw http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: rw}
+	start := time.Now()
+
+	handler.ServeHTTP(recorder, r)
+
+	if duration := time.Since(start); duration > threshold {
+		log.Printf("Slow request: method=%s path=%s status=%d duration=%s\n", r.Method, r.URL.Path, recorder.status, duration)
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+)
+
+// StatusMapping replaces the status From with To on broker responses to
+// requests with Method and a path matching Path, a pattern as understood by
+// path.Match, e.g. /v2/service_instances/*/service_bindings/*.
+type StatusMapping struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+func (m StatusMapping) matches(res *http.Response) bool {
+	if res.StatusCode != m.From || res.Request.Method != m.Method {
+		return false
+	}
+	matched, err := path.Match(m.Path, res.Request.URL.Path)
+	return err == nil && matched
+}
+
+func remapStatus(mappings []StatusMapping) func(*http.Response) error {
+	return func(res *http.Response) error {
+		for _, mapping := range mappings {
+			if mapping.matches(res) {
+				res.StatusCode = mapping.To
+				res.Status = fmt.Sprintf("%d %s", mapping.To, http.StatusText(mapping.To))
+				return nil
+			}
+		}
+		return nil
+	}
+}
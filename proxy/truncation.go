@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+)
+
+// detectTruncation wraps the broker response body to log when reading it
+// fails part way, typically because the broker closed the connection. The
+// status line and headers have already reached the client by then; the
+// reverse proxy aborts the client connection so the body is not mistaken for
+// a complete one.
+func detectTruncation(res *http.Response) {
+	res.Body = &truncationBody{ReadCloser: res.Body, res: res}
+}
+
+type truncationBody struct {
+	io.ReadCloser
+	res    *http.Response
+	n      int64
+	logged bool
+}
+
+func (b *truncationBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF && !b.logged && b.res.Request.Context().Err() == nil {
+		b.logged = true
+		req := b.res.Request
+		log.Printf("Broker response truncated: method=%s path=%s status=%d bytes=%d error=%s\n", req.Method, req.URL.Path, b.res.StatusCode, b.n, err)
+	}
+	return n, err
+}
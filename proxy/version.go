@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// ByAPIVersion hands each request to the handler registered for its
+// X-Broker-API-Version, e.g. to move platforms speaking a newer version to a
+// new broker first. Requests with other or no versions go to fallback.
+func ByAPIVersion(handlers map[string]http.Handler, fallback http.Handler) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		handler, ok := handlers[r.Header.Get(osb.APIVersionHeader)]
+		if !ok {
+			handler = fallback
+		}
+
+		handler.ServeHTTP(rw, r)
+		next(rw, r)
+	})
+}
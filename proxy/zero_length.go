@@ -0,0 +1,15 @@
+package proxy
+
+import "net/http"
+
+// sendZeroContentLength makes a bodyless outgoing request carry an explicit
+// Content-Length: 0. net/http only sends it for POST, PUT and PATCH, or for
+// other methods when the transfer encoding is explicitly identity, which it
+// ignores for a nil body. GET and HEAD stay without.
+func sendZeroContentLength(req *http.Request) {
+	if req.ContentLength != 0 || req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return
+	}
+	req.Body = http.NoBody
+	req.TransferEncoding = []string{"identity"}
+}
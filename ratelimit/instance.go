@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// DefaultInstanceLimiters is the number of service instances whose rate
+// InstanceLimiter tracks at once unless told otherwise.
+const DefaultInstanceLimiters = 10000
+
+// InstanceLimiter limits requests to each service instance to a fixed rate, so
+// a platform stuck in a loop on one instance cannot take down the broker for
+// every other instance. It keeps a Limiter for the most recently used
+// instances only; an instance that was evicted starts over with a full burst.
+type InstanceLimiter struct {
+	perSecond float64
+	burst     int
+	size      int
+
+	mu       sync.Mutex
+	recent   *list.List
+	limiters map[string]*list.Element
+}
+
+type instanceEntry struct {
+	instanceID string
+	limiter    *Limiter
+}
+
+func NewInstanceLimiter(perSecond float64, burst, size int) *InstanceLimiter {
+	if size < 1 {
+		size = DefaultInstanceLimiters
+	}
+	return &InstanceLimiter{
+		perSecond: perSecond,
+		burst:     burst,
+		size:      size,
+		recent:    list.New(),
+		limiters:  map[string]*list.Element{},
+	}
+}
+
+// Allow reports whether a request to instanceID may be sent now and, if not,
+// how long until it may.
+func (l *InstanceLimiter) Allow(instanceID string) (time.Duration, bool) {
+	wait, ok := l.limiter(instanceID).reserve(time.Now(), 0)
+	return wait, ok
+}
+
+func (l *InstanceLimiter) limiter(instanceID string) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.limiters[instanceID]; ok {
+		l.recent.MoveToFront(e)
+		return e.Value.(*instanceEntry).limiter
+	}
+
+	if l.recent.Len() >= l.size {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.limiters, oldest.Value.(*instanceEntry).instanceID)
+	}
+
+	entry := &instanceEntry{instanceID: instanceID, limiter: New(l.perSecond, l.burst)}
+	l.limiters[instanceID] = l.recent.PushFront(entry)
+	return entry.limiter
+}
+
+// Middleware responds with a 429 to requests for a service instance that is
+// over its rate. Requests that do not name an instance are not limited.
+func (l *InstanceLimiter) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		route := osb.Parse(r.Method, r.URL.Path)
+		if route.InstanceID == "" {
+			next(w, r)
+			return
+		}
+
+		if wait, ok := l.Allow(route.InstanceID); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"description":"Too many requests for this service instance"}`))
+			return
+		}
+
+		next(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/ratelimit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("InstanceLimiter", func() {
+	var (
+		size    int
+		served  []string
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		size = 0
+		served = nil
+	})
+
+	JustBeforeEach(func() {
+		n := negroni.New(ratelimit.NewInstanceLimiter(1, 2, size).Middleware())
+		n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = append(served, r.URL.Path)
+		})
+		handler = n
+	})
+
+	var send = func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	It("throttles an instance over its rate while other instances proceed", func() {
+		Expect(send("GET", "/v2/service_instances/inst-1").Code).To(Equal(http.StatusOK))
+		Expect(send("GET", "/v2/service_instances/inst-1/last_operation").Code).To(Equal(http.StatusOK))
+
+		w := send("PATCH", "/v2/service_instances/inst-1")
+		Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(w.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(w.Body.String()).To(MatchJSON(`{"description":"Too many requests for this service instance"}`))
+
+		for i := 0; i < 2; i++ {
+			Expect(send("PUT", "/v2/service_instances/inst-2/service_bindings/bind-1").Code).To(Equal(http.StatusOK))
+		}
+
+		Expect(served).To(Equal([]string{
+			"/v2/service_instances/inst-1",
+			"/v2/service_instances/inst-1/last_operation",
+			"/v2/service_instances/inst-2/service_bindings/bind-1",
+			"/v2/service_instances/inst-2/service_bindings/bind-1",
+		}))
+	})
+
+	It("does not limit requests that do not name an instance", func() {
+		for i := 0; i < 3; i++ {
+			Expect(send("GET", "/v2/catalog").Code).To(Equal(http.StatusOK))
+		}
+	})
+
+	Context("when more instances are used than it tracks", func() {
+		BeforeEach(func() {
+			size = 1
+		})
+
+		It("forgets the least recently used instance", func() {
+			send("GET", "/v2/service_instances/inst-1")
+			send("GET", "/v2/service_instances/inst-1")
+			Expect(send("GET", "/v2/service_instances/inst-1").Code).To(Equal(http.StatusTooManyRequests))
+
+			Expect(send("GET", "/v2/service_instances/inst-2").Code).To(Equal(http.StatusOK))
+			Expect(send("GET", "/v2/service_instances/inst-1").Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,19 @@
+package ratelimit
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// OperationPriority ranks requests that change instances or bindings above
+// everything else, so frequent last_operation polls and reads do not hold up
+// provisioning and binding when the broker is saturated.
+func OperationPriority(r *http.Request) int {
+	switch osb.Parse(r.Method, r.URL.Path).Operation {
+	case osb.Provision, osb.Update, osb.Deprovision, osb.Bind, osb.Unbind:
+		return 1
+	default:
+		return 0
+	}
+}
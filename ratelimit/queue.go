@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+var (
+	// ErrQueueFull is returned when every slot is taken and the queue for
+	// them is full.
+	ErrQueueFull = errors.New("Too many requests are waiting for the broker")
+	// ErrQueueTimeout is returned when no slot freed up within the maximum
+	// wait.
+	ErrQueueTimeout = errors.New("Timed out waiting for a free slot to the broker")
+)
+
+// Queue lets at most a fixed number of requests through at once. Requests
+// beyond that wait in a bounded queue and are let through as slots free up,
+// highest priority first and in arrival order within a priority.
+type Queue struct {
+	mu       sync.Mutex
+	slots    int
+	active   int
+	capacity int
+	maxWait  time.Duration
+	waiting  []*waiter
+	priority func(*http.Request) int
+}
+
+type waiter struct {
+	ready    chan struct{}
+	priority int
+}
+
+type QueueOption func(*Queue)
+
+// WithPriority lets the Middleware queue requests by the priority returned
+// for them, e.g. OperationPriority. Without it every request has priority 0.
+func WithPriority(priority func(*http.Request) int) QueueOption {
+	return func(q *Queue) {
+		q.priority = priority
+	}
+}
+
+// NewQueue allows slots concurrent requests, queueing up to capacity more
+// for at most maxWait each. A capacity of 0 rejects as soon as every slot is
+// taken.
+func NewQueue(slots, capacity int, maxWait time.Duration, opts ...QueueOption) *Queue {
+	if slots < 1 {
+		slots = 1
+	}
+	q := &Queue{slots: slots, capacity: capacity, maxWait: maxWait}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// Acquire waits for a slot with priority 0, failing with ErrQueueFull,
+// ErrQueueTimeout or the error of ctx. The returned function frees the slot
+// again.
+func (q *Queue) Acquire(ctx context.Context) (func(), error) {
+	return q.AcquirePriority(ctx, 0)
+}
+
+// AcquirePriority is Acquire for a request that is let through ahead of
+// queued requests with a lower priority.
+func (q *Queue) AcquirePriority(ctx context.Context, priority int) (func(), error) {
+	q.mu.Lock()
+	if q.active < q.slots && len(q.waiting) == 0 {
+		q.active++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	if len(q.waiting) >= q.capacity {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{ready: make(chan struct{}), priority: priority}
+	q.waiting = append(q.waiting, w)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return q.release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if !q.leave(w) {
+		// The slot was handed over while giving up; pass it on.
+		q.release()
+	}
+	return nil, err
+}
+
+// leave removes w from the queue, reporting false when it was no longer
+// queued because a slot has been handed to it.
+func (q *Queue) leave(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, queued := range q.waiting {
+		if queued == w {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release hands the slot to the longest waiting request of the highest
+// priority, if any.
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.active--
+		return
+	}
+
+	next := 0
+	for i, w := range q.waiting {
+		if w.priority > q.waiting[next].priority {
+			next = i
+		}
+	}
+	close(q.waiting[next].ready)
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+}
+
+// Middleware serves each request once it holds a slot and responds with a
+// 503 when it cannot get one.
+func (q *Queue) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		priority := 0
+		if q.priority != nil {
+			priority = q.priority(r)
+		}
+
+		release, err := q.AcquirePriority(r.Context(), priority)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		defer release()
+
+		next(w, r)
+	})
+}
@@ -0,0 +1,153 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/ratelimit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		served  chan string
+		unblock chan struct{}
+		handler http.Handler
+	)
+
+	var newHandler = func(queue *ratelimit.Queue) http.Handler {
+		n := negroni.New(queue.Middleware())
+		n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served <- r.URL.Path
+			<-unblock
+		})
+		return n
+	}
+
+	// send serves a request in the background and returns its response once
+	// it completes.
+	var sendMethod = func(method, path string) chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			done <- w
+		}()
+		return done
+	}
+
+	var send = func(path string) chan *httptest.ResponseRecorder {
+		return sendMethod("GET", path)
+	}
+
+	BeforeEach(func() {
+		served = make(chan string, 10)
+		unblock = make(chan struct{})
+	})
+
+	Context("with a slot and room to queue", func() {
+		BeforeEach(func() {
+			handler = newHandler(ratelimit.NewQueue(1, 2, time.Second))
+		})
+
+		It("serves queued requests in arrival order as slots free up", func() {
+			first := send("/first")
+			Eventually(served).Should(Receive(Equal("/first")))
+
+			second := send("/second")
+			time.Sleep(10 * time.Millisecond)
+			third := send("/third")
+			Consistently(served).ShouldNot(Receive())
+
+			unblock <- struct{}{}
+			Eventually(first).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+			Eventually(served).Should(Receive(Equal("/second")))
+
+			unblock <- struct{}{}
+			Eventually(second).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+			Eventually(served).Should(Receive(Equal("/third")))
+
+			unblock <- struct{}{}
+			Eventually(third).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+		})
+	})
+
+	Context("with operation priorities", func() {
+		BeforeEach(func() {
+			handler = newHandler(ratelimit.NewQueue(1, 3, time.Second, ratelimit.WithPriority(ratelimit.OperationPriority)))
+		})
+
+		It("admits a provision ahead of queued last_operation polls", func() {
+			first := send("/v2/service_instances/1/last_operation")
+			Eventually(served).Should(Receive())
+
+			poll := send("/v2/service_instances/2/last_operation")
+			time.Sleep(10 * time.Millisecond)
+			provision := sendMethod("PUT", "/v2/service_instances/3")
+			time.Sleep(10 * time.Millisecond)
+			Consistently(served).ShouldNot(Receive())
+
+			unblock <- struct{}{}
+			Eventually(first).Should(Receive())
+			Eventually(served).Should(Receive(Equal("/v2/service_instances/3")))
+
+			unblock <- struct{}{}
+			Eventually(provision).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+			Eventually(served).Should(Receive(Equal("/v2/service_instances/2/last_operation")))
+
+			unblock <- struct{}{}
+			Eventually(poll).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+		})
+	})
+
+	Context("when the queue is full", func() {
+		BeforeEach(func() {
+			handler = newHandler(ratelimit.NewQueue(1, 1, time.Second))
+		})
+
+		It("rejects further requests right away", func() {
+			first := send("/first")
+			Eventually(served).Should(Receive())
+			second := send("/second")
+			time.Sleep(10 * time.Millisecond)
+
+			var w *httptest.ResponseRecorder
+			Eventually(send("/third"), 100*time.Millisecond).Should(Receive(&w))
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(w.Body.String()).To(Equal(ratelimit.ErrQueueFull.Error()))
+
+			close(unblock)
+			Eventually(first).Should(Receive())
+			Eventually(second).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+		})
+	})
+
+	Context("when no slot frees up in time", func() {
+		BeforeEach(func() {
+			handler = newHandler(ratelimit.NewQueue(1, 1, 20*time.Millisecond))
+		})
+
+		It("rejects the queued request once the wait times out", func() {
+			first := send("/first")
+			Eventually(served).Should(Receive())
+
+			var w *httptest.ResponseRecorder
+			Eventually(send("/second")).Should(Receive(&w))
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(w.Body.String()).To(Equal(ratelimit.ErrQueueTimeout.Error()))
+
+			close(unblock)
+			Eventually(first).Should(Receive())
+
+			Eventually(send("/third")).Should(Receive(WithTransform(code, Equal(http.StatusOK))))
+		})
+	})
+})
+
+func code(w *httptest.ResponseRecorder) int {
+	return w.Code
+}
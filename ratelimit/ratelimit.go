@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned when waiting for the rate limit would take
+// longer than the deadline of the request.
+var ErrDeadlineExceeded = errors.New("Waiting for the broker rate limit would exceed the request deadline")
+
+// Limiter paces requests to at most a fixed rate, letting up to burst requests
+// through at once.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	tat      time.Time
+}
+
+func New(perSecond float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / perSecond), burst: burst}
+}
+
+// Wait blocks until a request may be sent. It fails right away with
+// ErrDeadlineExceeded when the wait would outlast the deadline of ctx.
+func (l *Limiter) Wait(ctx context.Context) error {
+	maxWait := time.Duration(1<<63 - 1)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = time.Until(deadline)
+	}
+
+	wait, ok := l.reserve(time.Now(), maxWait)
+	if !ok {
+		return ErrDeadlineExceeded
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes the next free slot unless it is more than maxWait away, using
+// the theoretical arrival time of the generic cell rate algorithm.
+func (l *Limiter) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	wait := tat.Sub(now) - time.Duration(l.burst-1)*l.interval
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+
+	l.tat = tat.Add(l.interval)
+	return wait, true
+}
+
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Doer sends requests through an HTTPDoer once the Limiter allows them.
+type Doer struct {
+	doer    HTTPDoer
+	limiter *Limiter
+}
+
+func NewDoer(doer HTTPDoer, limiter *Limiter) *Doer {
+	return &Doer{doer: doer, limiter: limiter}
+}
+
+func (d *Doer) Do(req *http.Request) (*http.Response, error) {
+	if err := d.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return d.doer.Do(req)
+}
@@ -0,0 +1,76 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/ratelimit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("Doer", func() {
+	var (
+		sent []time.Time
+		doer *ratelimit.Doer
+	)
+
+	BeforeEach(func() {
+		sent = nil
+		doer = ratelimit.NewDoer(doerFunc(func(req *http.Request) (*http.Response, error) {
+			sent = append(sent, time.Now())
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}), ratelimit.New(20, 2))
+	})
+
+	var do = func(ctx context.Context) error {
+		req, _ := http.NewRequest("GET", "http://broker.example.com/v2/catalog", nil)
+		_, err := doer.Do(req.WithContext(ctx))
+		return err
+	}
+
+	It("lets a burst through and paces the requests after it", func() {
+		for i := 0; i < 4; i++ {
+			Expect(do(context.Background())).To(Succeed())
+		}
+
+		Expect(sent).To(HaveLen(4))
+		Expect(sent[1].Sub(sent[0])).To(BeNumerically("<", 25*time.Millisecond))
+		Expect(sent[2].Sub(sent[0])).To(BeNumerically(">=", 45*time.Millisecond))
+		Expect(sent[3].Sub(sent[0])).To(BeNumerically(">=", 95*time.Millisecond))
+	})
+
+	It("rejects requests whose deadline would pass while waiting", func() {
+		Expect(do(context.Background())).To(Succeed())
+		Expect(do(context.Background())).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		Expect(do(ctx)).To(MatchError(ratelimit.ErrDeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Millisecond))
+		Expect(sent).To(HaveLen(2))
+	})
+
+	It("does not use up a slot for rejected requests", func() {
+		Expect(do(context.Background())).To(Succeed())
+		Expect(do(context.Background())).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		Expect(do(ctx)).To(HaveOccurred())
+
+		start := time.Now()
+		Expect(do(context.Background())).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 75*time.Millisecond))
+	})
+})
@@ -0,0 +1,89 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// Path is where the recorded requests are served when the recorder is enabled.
+const Path = "/_proxy/requests"
+
+type Entry struct {
+	Time    time.Time   `json:"time"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers"`
+	Status  int         `json:"status"`
+}
+
+// Recorder keeps the most recent proxied requests in a fixed size ring buffer.
+// It is meant for debugging and testing what the platform sends.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func New(size int) *Recorder {
+	if size < 1 {
+		size = 1
+	}
+	return &Recorder{entries: make([]Entry, size)}
+}
+
+func (rec *Recorder) Middleware() negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		rw, ok := w.(negroni.ResponseWriter)
+		if !ok {
+			rw = negroni.NewResponseWriter(w)
+		}
+
+		start := time.Now()
+		next(rw, r)
+
+		rec.add(Entry{
+			Time:    start,
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   redact.Query(r.URL.RawQuery),
+			Headers: redact.Header(r.Header),
+			Status:  rw.Status(),
+		})
+	})
+}
+
+// Entries returns the recorded requests, oldest first.
+func (rec *Recorder) Entries() []Entry {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if !rec.full {
+		return append([]Entry(nil), rec.entries[:rec.next]...)
+	}
+	return append(append([]Entry(nil), rec.entries[rec.next:]...), rec.entries[:rec.next]...)
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec.Entries())
+}
+
+func (rec *Recorder) add(e Entry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.entries[rec.next] = e
+	rec.next++
+	if rec.next == len(rec.entries) {
+		rec.next = 0
+		rec.full = true
+	}
+}
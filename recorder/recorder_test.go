@@ -0,0 +1,79 @@
+package recorder_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/recorder"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		rec     *recorder.Recorder
+		status  int
+		proxied = func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Authorization", "Bearer secret-token")
+			w.WriteHeader(status)
+		}
+	)
+
+	BeforeEach(func() {
+		rec = recorder.New(2)
+		status = http.StatusCreated
+	})
+
+	var send = func(method, target string) {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Broker-API-Version", "2.14")
+		rec.Middleware()(httptest.NewRecorder(), req, proxied)
+	}
+
+	It("records proxied requests with their broker status", func() {
+		send("PUT", "/v2/service_instances/123?accepts_incomplete=true")
+
+		entries := rec.Entries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Method).To(Equal("PUT"))
+		Expect(entries[0].Path).To(Equal("/v2/service_instances/123"))
+		Expect(entries[0].Query).To(Equal("accepts_incomplete=true"))
+		Expect(entries[0].Headers.Get("X-Broker-API-Version")).To(Equal("2.14"))
+		Expect(entries[0].Status).To(Equal(http.StatusCreated))
+		Expect(entries[0].Time).NotTo(BeZero())
+	})
+
+	It("redacts the token in the recorded headers", func() {
+		send("GET", "/v2/catalog")
+
+		Expect(rec.Entries()[0].Headers.Get("Authorization")).To(Equal("Bearer [REDACTED]"))
+	})
+
+	It("keeps only the most recent requests", func() {
+		send("GET", "/v2/catalog")
+		send("GET", "/v2/service_instances/1")
+		send("GET", "/v2/service_instances/2")
+
+		entries := rec.Entries()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Path).To(Equal("/v2/service_instances/1"))
+		Expect(entries[1].Path).To(Equal("/v2/service_instances/2"))
+	})
+
+	It("serves the recorded requests as JSON", func() {
+		send("GET", "/v2/catalog")
+
+		w := httptest.NewRecorder()
+		rec.ServeHTTP(w, httptest.NewRequest("GET", recorder.Path, nil))
+
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var entries []recorder.Entry
+		Expect(json.Unmarshal(w.Body.Bytes(), &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Path).To(Equal("/v2/catalog"))
+		Expect(w.Body.String()).NotTo(ContainSubstring("secret-token"))
+	})
+})
@@ -0,0 +1,35 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+var sensitiveQuery atomic.Value
+
+// SetQueryParams sets the query parameters whose values are redacted by Query.
+// No parameter is redacted by default.
+func SetQueryParams(names ...string) {
+	if len(names) == 0 {
+		sensitiveQuery.Store((*regexp.Regexp)(nil))
+		return
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	sensitiveQuery.Store(regexp.MustCompile(`(^|[?&;])(` + strings.Join(quoted, "|") + `)=[^&;#\s"']*`))
+}
+
+// Query replaces the values of the parameters set with SetQueryParams in s,
+// which may be a raw query, a URL or a message quoting one. The parameter
+// names are kept, e.g. "token=[REDACTED]".
+func Query(s string) string {
+	pattern, _ := sensitiveQuery.Load().(*regexp.Regexp)
+	if pattern == nil {
+		return s
+	}
+	return pattern.ReplaceAllString(s, "${1}${2}="+Redacted)
+}
@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"net/http"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+// Header returns a copy of h that is safe to log or serialize. Credentials in
+// sensitive headers are replaced, keeping the auth scheme for debugging, e.g.
+// "Bearer [REDACTED]".
+func Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		redacted[name] = append([]string(nil), values...)
+	}
+
+	for _, name := range sensitiveHeaders {
+		values := redacted[http.CanonicalHeaderKey(name)]
+		for i, v := range values {
+			values[i] = credentialsValue(v)
+		}
+	}
+
+	return redacted
+}
+
+// Secrets removes every credential carried in the sensitive headers of h, and
+// the values of sensitive query parameters, from s. It is meant for error
+// messages that may echo parts of a request.
+func Secrets(s string, h http.Header) string {
+	s = Query(s)
+
+	for _, name := range sensitiveHeaders {
+		for _, v := range h[http.CanonicalHeaderKey(name)] {
+			if credentials := credentials(v); credentials != "" {
+				s = strings.Replace(s, credentials, Redacted, -1)
+			}
+		}
+	}
+
+	return s
+}
+
+func credentialsValue(v string) string {
+	if i := strings.IndexByte(v, ' '); i >= 0 {
+		return v[:i] + " " + Redacted
+	}
+	return Redacted
+}
+
+func credentials(v string) string {
+	if i := strings.IndexByte(v, ' '); i >= 0 {
+		return strings.TrimSpace(v[i+1:])
+	}
+	return strings.TrimSpace(v)
+}
+
+// Error wraps err so that its message has the credentials of h removed. The
+// original error can still be reached with errors.Is and errors.As.
+func Error(err error, h http.Header) error {
+	return &redactedError{err: err, msg: Secrets(err.Error(), h)}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
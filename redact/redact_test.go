@@ -0,0 +1,102 @@
+package redact_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redact", func() {
+	var header http.Header
+
+	BeforeEach(func() {
+		header = http.Header{}
+		header.Set("Authorization", "Bearer my-secret-token")
+		header.Set("Proxy-Authorization", "Basic dXNlcjpwYXNz")
+		header.Set("Accept", "application/json")
+	})
+
+	Describe("Header", func() {
+		It("redacts the credentials while keeping the scheme", func() {
+			redacted := redact.Header(header)
+
+			Expect(redacted.Get("Authorization")).To(Equal("Bearer [REDACTED]"))
+			Expect(redacted.Get("Proxy-Authorization")).To(Equal("Basic [REDACTED]"))
+		})
+
+		It("leaves other headers alone", func() {
+			Expect(redact.Header(header).Get("Accept")).To(Equal("application/json"))
+		})
+
+		It("does not modify the given header", func() {
+			redact.Header(header)
+			Expect(header.Get("Authorization")).To(Equal("Bearer my-secret-token"))
+		})
+
+		It("redacts values without a scheme entirely", func() {
+			header.Set("Authorization", "my-secret-token")
+			Expect(redact.Header(header).Get("Authorization")).To(Equal("[REDACTED]"))
+		})
+	})
+
+	Describe("Secrets", func() {
+		It("removes credentials from the given string", func() {
+			msg := redact.Secrets("broker said: Bearer my-secret-token is invalid, dXNlcjpwYXNz too", header)
+
+			Expect(msg).To(Equal("broker said: Bearer [REDACTED] is invalid, [REDACTED] too"))
+		})
+
+		It("leaves strings without credentials alone", func() {
+			Expect(redact.Secrets("nothing to see", header)).To(Equal("nothing to see"))
+		})
+	})
+
+	Describe("Query", func() {
+		BeforeEach(func() {
+			redact.SetQueryParams("token", "api.key")
+		})
+
+		AfterEach(func() {
+			redact.SetQueryParams()
+		})
+
+		It("redacts the values of sensitive parameters in raw queries", func() {
+			Expect(redact.Query("token=abc&plan_id=1&api.key=xyz")).To(Equal("token=[REDACTED]&plan_id=1&api.key=[REDACTED]"))
+		})
+
+		It("redacts them in messages quoting a URL", func() {
+			msg := `Get "https://broker.example.com/v2/catalog?token=abc": connection refused`
+			Expect(redact.Query(msg)).To(Equal(`Get "https://broker.example.com/v2/catalog?token=[REDACTED]": connection refused`))
+		})
+
+		It("leaves parameters that only share a suffix alone", func() {
+			Expect(redact.Query("csrf_token=abc&apixkey=1")).To(Equal("csrf_token=abc&apixkey=1"))
+		})
+
+		It("is applied by Secrets", func() {
+			Expect(redact.Secrets("/v2/catalog?token=abc", header)).To(Equal("/v2/catalog?token=[REDACTED]"))
+		})
+
+		It("leaves everything alone when no parameter is set", func() {
+			redact.SetQueryParams()
+			Expect(redact.Query("token=abc")).To(Equal("token=abc"))
+		})
+	})
+
+	Describe("Error", func() {
+		It("removes credentials from the error message", func() {
+			err := redact.Error(errors.New("rejected my-secret-token"), header)
+			Expect(err).To(MatchError("rejected [REDACTED]"))
+		})
+
+		It("keeps the original error reachable", func() {
+			err := redact.Error(context.DeadlineExceeded, header)
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header.
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// maxProxyV1HeaderBytes is the longest v1 header the specification allows,
+// CRLF included.
+const maxProxyV1HeaderBytes = 107
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// WithProxyProtocol expects every connection accepted by ListenAndServe to
+// start with a PROXY protocol v1 or v2 header, as sent by TCP load balancers,
+// and reports the client address it carries as the RemoteAddr of requests.
+// Connections without a valid header within timeout, DefaultProxyHeaderTimeout
+// when zero, are closed. Listeners passed to Serve are used as they are.
+func WithProxyProtocol(timeout time.Duration) Option {
+	return func(s *Server) {
+		if timeout <= 0 {
+			timeout = DefaultProxyHeaderTimeout
+		}
+		s.proxyHeaderTimeout = timeout
+	}
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+// Accept leaves reading the header to the connection, so a slow client does
+// not hold up accepting others.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, timeout: l.timeout}, nil
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+// readHeader runs on first use of the connection, which net/http does from
+// the goroutine serving it.
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+
+		if c.err != nil {
+			log.Printf("Invalid PROXY protocol header from %s: %s\n", c.Conn.RemoteAddr(), c.err)
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a v1 or v2 header from r. It returns a nil address
+// for headers that carry none, such as health checks by the load balancer.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(signature, proxyV2Signature):
+		return readProxyV2Header(r)
+	case bytes.HasPrefix(signature, []byte("PROXY ")):
+		return readProxyV1Header(r)
+	default:
+		return nil, errors.New("missing PROXY protocol header")
+	}
+}
+
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > maxProxyV1HeaderBytes || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("malformed v1 header")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed v1 source address %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version %d", header[12]>>4)
+	}
+
+	addresses := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, addresses); err != nil {
+		return nil, err
+	}
+
+	// LOCAL connections, and families other than TCP over IPv4 or IPv6,
+	// keep the address of the connection itself.
+	if header[12]&0x0f != 1 {
+		return nil, nil
+	}
+	switch header[13] {
+	case 0x11:
+		if len(addresses) < 12 {
+			return nil, errors.New("truncated v2 IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 0x21:
+		if len(addresses) < 36 {
+			return nil, errors.New("truncated v2 IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/server"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithProxyProtocol", func() {
+	var (
+		listener    net.Listener
+		remoteAddrs chan string
+	)
+
+	BeforeEach(func() {
+		log.SetOutput(ioutil.Discard)
+
+		remoteAddrs = make(chan string, 1)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remoteAddrs <- r.RemoteAddr
+		})
+
+		srv := server.New("127.0.0.1:0", handler, server.WithProxyProtocol(200*time.Millisecond))
+		var err error
+		listener, err = srv.Listen()
+		Expect(err).NotTo(HaveOccurred())
+		go srv.Serve(listener)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		log.SetOutput(os.Stderr)
+	})
+
+	// send writes header and a request on a new connection and returns the
+	// response status, or an error once the server closes the connection.
+	var send = func(header []byte) (int, error) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		conn.Write(header)
+		conn.Write([]byte("GET /v2/catalog HTTP/1.1\r\nHost: proxy\r\n\r\n"))
+
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	var v2Header = func(command byte, family byte, addresses []byte) []byte {
+		header := bytes.NewBufferString("\r\n\r\n\x00\r\nQUIT\n")
+		header.WriteByte(0x20 | command)
+		header.WriteByte(family)
+		binary.Write(header, binary.BigEndian, uint16(len(addresses)))
+		header.Write(addresses)
+		return header.Bytes()
+	}
+
+	It("reports the client address from a v1 header", func() {
+		status, err := send([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(<-remoteAddrs).To(Equal("203.0.113.7:51234"))
+	})
+
+	It("reports the client address from a v2 header", func() {
+		addresses := []byte{203, 0, 113, 8, 10, 0, 0, 1, 0xc8, 0x23, 0x1f, 0x90}
+		// A TLV after the addresses is skipped.
+		addresses = append(addresses, 0x04, 0x00, 0x01, 0x00)
+
+		status, err := send(v2Header(1, 0x11, addresses))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(<-remoteAddrs).To(Equal("203.0.113.8:51235"))
+	})
+
+	It("reports an IPv6 client address", func() {
+		status, err := send([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 443 8080\r\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(<-remoteAddrs).To(Equal("[2001:db8::1]:443"))
+	})
+
+	It("keeps the connection address for LOCAL and UNKNOWN headers", func() {
+		_, err := send(v2Header(0, 0x00, nil))
+		Expect(err).NotTo(HaveOccurred())
+		host, _, _ := net.SplitHostPort(<-remoteAddrs)
+		Expect(host).To(Equal("127.0.0.1"))
+
+		_, err = send([]byte("PROXY UNKNOWN\r\n"))
+		Expect(err).NotTo(HaveOccurred())
+		host, _, _ = net.SplitHostPort(<-remoteAddrs)
+		Expect(host).To(Equal("127.0.0.1"))
+	})
+
+	It("closes connections without a header", func() {
+		_, err := send(nil)
+		Expect(err).To(HaveOccurred())
+		Consistently(remoteAddrs).ShouldNot(Receive())
+	})
+
+	It("closes connections that do not send a header in time", func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		start := time.Now()
+		conn.SetReadDeadline(start.Add(2 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
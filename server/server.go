@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReadDrainTimeout     = 5 * time.Second
+	DefaultMutatingDrainTimeout = 30 * time.Second
+
+	// DefaultMaxHeaderBytes leaves plenty of room for OSB headers, such as
+	// originating identities and B3 traces, well below net/http's 1 MB.
+	DefaultMaxHeaderBytes = 64 << 10
+)
+
+type Option func(*Server)
+
+// Server serves the proxy and shuts it down gracefully. On shutdown, in-flight
+// reads are given readDrain to finish, while mutating requests such as
+// provisioning are given the longer mutatingDrain.
+type Server struct {
+	httpServer    *http.Server
+	readDrain     time.Duration
+	mutatingDrain time.Duration
+	socketOptions SocketOptions
+
+	proxyHeaderTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight map[*request]struct{}
+}
+
+type request struct {
+	mutating bool
+	cancel   context.CancelFunc
+}
+
+func New(addr string, handler http.Handler, opts ...Option) *Server {
+	s := &Server{
+		readDrain:     DefaultReadDrainTimeout,
+		mutatingDrain: DefaultMutatingDrainTimeout,
+		inFlight:      map[*request]struct{}{},
+	}
+	s.httpServer = &http.Server{Addr: addr, Handler: s.track(handler), MaxHeaderBytes: DefaultMaxHeaderBytes}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func WithDrainTimeouts(read, mutating time.Duration) Option {
+	return func(s *Server) {
+		s.readDrain = read
+		s.mutatingDrain = mutating
+	}
+}
+
+// WithMaxHeaderBytes caps the size of request headers. Requests with larger
+// headers are answered with a 431 by net/http, which allows a few kilobytes
+// of slack on top of max.
+func WithMaxHeaderBytes(max int) Option {
+	return func(s *Server) {
+		s.httpServer.MaxHeaderBytes = max
+	}
+}
+
+func (s *Server) ListenAndServe() error {
+	listener, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.httpServer.Serve(listener)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	return s.httpServer.Serve(l)
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones to drain.
+// Reads still running after the read drain timeout are canceled, and any
+// request still running after the mutating drain timeout is cut off.
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.mutatingDrain)
+	defer cancel()
+
+	readTimer := time.AfterFunc(s.readDrain, func() {
+		s.cancelInFlight(false)
+	})
+	defer readTimer.Stop()
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		s.cancelInFlight(true)
+		s.httpServer.Close()
+	}
+
+	return err
+}
+
+// InFlight returns the number of reads and mutating requests being served.
+func (s *Server) InFlight() (reads, mutating int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for req := range s.inFlight {
+		if req.mutating {
+			mutating++
+		} else {
+			reads++
+		}
+	}
+	return reads, mutating
+}
+
+func (s *Server) track(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		req := &request{mutating: isMutating(r.Method), cancel: cancel}
+
+		s.mu.Lock()
+		s.inFlight[req] = struct{}{}
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			delete(s.inFlight, req)
+			s.mu.Unlock()
+		}()
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Server) cancelInFlight(includeMutating bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for req := range s.inFlight {
+		if !req.mutating || includeMutating {
+			req.cancel()
+		}
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
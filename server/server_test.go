@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/server"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		listener net.Listener
+		srv      *server.Server
+		started  chan string
+		release  chan struct{}
+		canceled chan string
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		started = make(chan string, 2)
+		canceled = make(chan string, 2)
+		release = make(chan struct{})
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- r.Method
+			select {
+			case <-release:
+				w.WriteHeader(http.StatusOK)
+			case <-r.Context().Done():
+				canceled <- r.Method
+			}
+		})
+
+		srv = server.New("", handler, server.WithDrainTimeouts(50*time.Millisecond, 2*time.Second))
+		go srv.Serve(listener)
+	})
+
+	var send = func(method string) chan int {
+		status := make(chan int, 1)
+		go func() {
+			defer GinkgoRecover()
+			req, _ := http.NewRequest(method, "http://"+listener.Addr().String()+"/v2/service_instances/123", nil)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				status <- -1
+				return
+			}
+			res.Body.Close()
+			status <- res.StatusCode
+		}()
+		return status
+	}
+
+	It("serves requests", func() {
+		close(release)
+		Eventually(send("GET")).Should(Receive(Equal(http.StatusOK)))
+	})
+
+	It("counts in-flight requests", func() {
+		send("GET")
+		send("PUT")
+		Eventually(started).Should(Receive())
+		Eventually(started).Should(Receive())
+
+		reads, mutating := srv.InFlight()
+		Expect(reads).To(Equal(1))
+		Expect(mutating).To(Equal(1))
+
+		close(release)
+		Eventually(func() int { r, m := srv.InFlight(); return r + m }).Should(BeZero())
+	})
+
+	Describe("Shutdown", func() {
+		It("gives mutating requests longer to drain than reads", func() {
+			getStatus := send("GET")
+			putStatus := send("PUT")
+			Eventually(started).Should(Receive())
+			Eventually(started).Should(Receive())
+
+			shutdownErr := make(chan error, 1)
+			go func() { shutdownErr <- srv.Shutdown() }()
+
+			Eventually(canceled).Should(Receive(Equal("GET")))
+			Consistently(canceled, 200*time.Millisecond).ShouldNot(Receive())
+
+			close(release)
+
+			Eventually(putStatus).Should(Receive(Equal(http.StatusOK)))
+			Eventually(getStatus).Should(Receive())
+			Eventually(shutdownErr).Should(Receive(BeNil()))
+		})
+
+		It("cuts off mutating requests after the mutating drain timeout", func() {
+			srv = server.New("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				started <- r.Method
+				<-r.Context().Done()
+				canceled <- r.Method
+			}), server.WithDrainTimeouts(10*time.Millisecond, 100*time.Millisecond))
+
+			listener.Close()
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go srv.Serve(listener)
+
+			send("PUT")
+			Eventually(started).Should(Receive())
+
+			start := time.Now()
+			err = srv.Shutdown()
+
+			Expect(err).To(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+			Eventually(canceled).Should(Receive(Equal("PUT")))
+		})
+
+		It("returns once idle", func() {
+			Expect(srv.Shutdown()).To(Succeed())
+
+			_, err := http.Get("http://" + listener.Addr().String())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("WithMaxHeaderBytes", func() {
+	var listener net.Listener
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		go server.New("", handler, server.WithMaxHeaderBytes(1024)).Serve(listener)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	var get = func(headerSize int) int {
+		req, _ := http.NewRequest("GET", "http://"+listener.Addr().String()+"/v2/catalog", nil)
+		req.Header.Set("X-Padding", strings.Repeat("x", headerSize))
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	It("serves requests with normal headers", func() {
+		Expect(get(512)).To(Equal(http.StatusOK))
+	})
+
+	It("answers requests with oversized headers with a 431", func() {
+		Expect(get(16 << 10)).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+	})
+})
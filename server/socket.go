@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+)
+
+// SocketOptions tune the TCP connections the server accepts.
+type SocketOptions struct {
+	// Nagle turns Nagle's algorithm back on. Go sets TCP_NODELAY on every
+	// connection, which suits the small requests and responses of OSB.
+	Nagle bool
+	// ReadBuffer and WriteBuffer set the socket buffer sizes in bytes.
+	// Zero leaves the operating system defaults.
+	ReadBuffer  int
+	WriteBuffer int
+}
+
+// WithSocketOptions applies opts to every connection accepted by
+// ListenAndServe. Listeners passed to Serve are used as they are.
+func WithSocketOptions(opts SocketOptions) Option {
+	return func(s *Server) {
+		s.socketOptions = opts
+	}
+}
+
+// Listen opens the listener ListenAndServe serves on.
+func (s *Server) Listen() (net.Listener, error) {
+	addr := s.httpServer.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	listener = &tunedListener{Listener: listener, opts: s.socketOptions}
+	if s.proxyHeaderTimeout > 0 {
+		listener = &proxyProtocolListener{Listener: listener, timeout: s.proxyHeaderTimeout}
+	}
+	return listener, nil
+}
+
+type tunedListener struct {
+	net.Listener
+	opts SocketOptions
+}
+
+func (l *tunedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err := l.opts.apply(tcp); err != nil {
+			log.Println("Failed to tune connection: " + err.Error())
+		}
+	}
+	return conn, nil
+}
+
+func (o SocketOptions) apply(conn *net.TCPConn) error {
+	if o.Nagle {
+		if err := conn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := conn.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := conn.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package server_test
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/server"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithSocketOptions", func() {
+	// accept opens the server's listener and returns the server side of a
+	// connection to it.
+	var accept = func(opts ...server.Option) *net.TCPConn {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		listener, err := server.New("127.0.0.1:0", handler, opts...).Listen()
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		client, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		conn, err := listener.Accept()
+		Expect(err).NotTo(HaveOccurred())
+		return conn.(*net.TCPConn)
+	}
+
+	var sockopt = func(conn *net.TCPConn, level, name int) int {
+		raw, err := conn.SyscallConn()
+		Expect(err).NotTo(HaveOccurred())
+
+		var value int
+		var sockErr error
+		Expect(raw.Control(func(fd uintptr) {
+			value, sockErr = syscall.GetsockoptInt(int(fd), level, name)
+		})).To(Succeed())
+		Expect(sockErr).NotTo(HaveOccurred())
+		return value
+	}
+
+	It("keeps TCP_NODELAY on by default", func() {
+		conn := accept()
+		defer conn.Close()
+
+		Expect(sockopt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY)).NotTo(BeZero())
+	})
+
+	It("applies the configured options to accepted connections", func() {
+		conn := accept(server.WithSocketOptions(server.SocketOptions{Nagle: true, ReadBuffer: 64 << 10, WriteBuffer: 64 << 10}))
+		defer conn.Close()
+
+		Expect(sockopt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY)).To(BeZero())
+		// Linux reports twice the size asked for, to account for its own
+		// bookkeeping.
+		Expect(sockopt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF)).To(BeNumerically(">=", 64<<10))
+		Expect(sockopt(conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF)).To(BeNumerically(">=", 64<<10))
+	})
+})
@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Path is where the snapshot is served when it is enabled.
+const Path = "/_proxy/snapshot"
+
+// Snapshot serves the current state of the proxy's subsystems as one JSON
+// object, keyed by subsystem. Sources must not return secrets.
+type Snapshot struct {
+	mu      sync.Mutex
+	sources map[string]func() interface{}
+}
+
+func New() *Snapshot {
+	return &Snapshot{sources: map[string]func() interface{}{}}
+}
+
+// Add registers source to report the state of the subsystem name.
+func (s *Snapshot) Add(name string, source func() interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[name] = source
+}
+
+func (s *Snapshot) State() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := make(map[string]interface{}, len(s.sources))
+	for name, source := range s.sources {
+		state[name] = source()
+	}
+	return state
+}
+
+func (s *Snapshot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.State())
+}
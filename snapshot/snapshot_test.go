@@ -0,0 +1,48 @@
+package snapshot_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/catalog"
+	"code.cloudfoundry.org/gcp-broker-proxy/snapshot"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	var snap *snapshot.Snapshot
+
+	BeforeEach(func() {
+		snap = snapshot.New()
+		snap.Add("token", func() interface{} { return map[string]string{"expiry": "2026-01-01T00:00:00Z"} })
+		snap.Add("catalog_cache", func() interface{} { return catalog.Stats{Hits: 3, Misses: 1} })
+		snap.Add("in_flight", func() interface{} { return map[string]int{"reads": 2, "mutating": 1} })
+		snap.Add("errors", func() interface{} { return map[string]uint64{"timeout": 4} })
+	})
+
+	It("serves the state of every subsystem as JSON", func() {
+		w := httptest.NewRecorder()
+		snap.ServeHTTP(w, httptest.NewRequest("GET", snapshot.Path, nil))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var state map[string]map[string]interface{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &state)).To(Succeed())
+		Expect(state).To(HaveLen(4))
+		Expect(state).To(HaveKey("token"))
+		Expect(state["catalog_cache"]).To(HaveKeyWithValue("hits", BeNumerically("==", 3)))
+		Expect(state["in_flight"]).To(HaveKeyWithValue("mutating", BeNumerically("==", 1)))
+		Expect(state["errors"]).To(HaveKeyWithValue("timeout", BeNumerically("==", 4)))
+	})
+
+	It("is read-only", func() {
+		w := httptest.NewRecorder()
+		snap.ServeHTTP(w, httptest.NewRequest("POST", snapshot.Path, nil))
+
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
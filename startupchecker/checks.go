@@ -1,15 +1,47 @@
 package startupchecker
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
-	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
+)
+
+// DefaultTimeout bounds Perform, so a misconfigured or unreachable broker
+// fails the boot quickly rather than after the generous timeouts real broker
+// requests are given.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultAPIVersion is the X-Broker-API-Version of the catalog requests,
+// unless WithAPIVersion says otherwise.
+const DefaultAPIVersion = "2.14"
+
+var (
+	ErrTokenRetrieval    = errors.New("Failed obtaining oauth token")
+	ErrBrokerUnreachable = errors.New("Failed to make request to the broker")
 )
 
+// BrokerStatusError is returned when the broker responds to the startup check
+// with anything but a 200.
+type BrokerStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *BrokerStatusError) Error() string {
+	return fmt.Sprintf("Broker did not respond successfully. status: %d body: %s", e.StatusCode, e.Body)
+}
+
 //go:generate counterfeiter . TokenRetriever
 type TokenRetriever interface {
 	GetToken() (*oauth2.Token, error)
@@ -21,51 +53,146 @@ type HTTPDoer interface {
 }
 
 type Checker struct {
-	brokerURL      *url.URL
-	tokenRetriever TokenRetriever
-	httpDoer       HTTPDoer
+	brokerURL       *url.URL
+	tokenRetriever  TokenRetriever
+	httpDoer        HTTPDoer
+	warmConnections int
+	timeout         time.Duration
+	apiVersion      string
 }
 
-func NewChecker(brokerURL *url.URL, tr TokenRetriever, httpDoer HTTPDoer) Checker {
-	return Checker{
+type Option func(*Checker)
+
+// WithWarmConnections makes n more catalog requests at once after the checks
+// pass, so the idle pool of the HTTPDoer holds connections to the broker
+// before the first real request.
+func WithWarmConnections(n int) Option {
+	return func(c *Checker) {
+		c.warmConnections = n
+	}
+}
+
+// WithTimeout bounds the checks run by Perform, warm-up included, instead of
+// DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Checker) {
+		c.timeout = timeout
+	}
+}
+
+// WithAPIVersion sends the catalog requests with version as their
+// X-Broker-API-Version instead of DefaultAPIVersion, for brokers that do not
+// support it.
+func WithAPIVersion(version string) Option {
+	return func(c *Checker) {
+		c.apiVersion = version
+	}
+}
+
+// NewChecker builds a Checker for the broker at brokerURL. A nil tr skips the
+// token step for brokers that need no token.
+func NewChecker(brokerURL *url.URL, tr TokenRetriever, httpDoer HTTPDoer, opts ...Option) Checker {
+	checker := Checker{
 		brokerURL:      brokerURL,
 		tokenRetriever: tr,
 		httpDoer:       httpDoer,
+		timeout:        DefaultTimeout,
+		apiVersion:     DefaultAPIVersion,
 	}
+	for _, opt := range opts {
+		opt(&checker)
+	}
+	return checker
 }
 
 // 1. Once the proxy is setup can we just call ourselves?
 func (s *Checker) Perform() error {
-	token, err := s.tokenRetriever.GetToken()
-	if err != nil {
-		return errors.Wrap(err, "Failed obtaining oauth token")
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	return s.PerformWithContext(ctx)
+}
+
+// PerformWithContext checks that a token can be obtained and that the broker
+// serves its catalog with it. Errors match ErrTokenRetrieval or
+// ErrBrokerUnreachable with errors.Is, or are a *BrokerStatusError. Given the
+// caching TokenRetriever the proxy uses, the token fetched here stays cached
+// for the first proxied requests.
+func (s *Checker) PerformWithContext(ctx context.Context) error {
+	var token *oauth2.Token
+	if s.tokenRetriever != nil {
+		var err error
+		if token, err = s.tokenRetriever.GetToken(); err != nil {
+			return fmt.Errorf("%w: %w", ErrTokenRetrieval, err)
+		}
 	}
 
-	req, err := http.NewRequest("GET", s.brokerURL.String()+"/v2/catalog", nil)
+	req, err := s.catalogRequest(ctx, token)
 	if err != nil {
-		return errors.Wrap(err, "Failed to create request")
+		return err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
-	req.Header.Add("x-broker-api-version", "2.14")
-
 	res, err := s.httpDoer.Do(req)
 
 	if err != nil {
-		return errors.Wrap(err, "Failed to make request to the broker")
+		return fmt.Errorf("%w: %w", ErrBrokerUnreachable, redact.Error(err, req.Header))
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		defer res.Body.Close()
 		bodyBytes, err := ioutil.ReadAll(res.Body)
 		var bodyString string
 		if err != nil {
 			bodyString = "Could not read body"
 		} else {
-			bodyString = string(bodyBytes)
+			bodyString = redact.Secrets(string(bodyBytes), req.Header)
 		}
-		return fmt.Errorf("Broker did not respond successfully. status: %d body: %s", res.StatusCode, bodyString)
+		return &BrokerStatusError{StatusCode: res.StatusCode, Body: bodyString}
 	}
 
+	s.warmUp(ctx, token)
+
 	return err
 }
+
+func (s *Checker) catalogRequest(ctx context.Context, token *oauth2.Token) (*http.Request, error) {
+	req, err := http.NewRequest("GET", s.brokerURL.String()+"/v2/catalog", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	if token != nil {
+		req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+	}
+	req.Header.Add("x-broker-api-version", s.apiVersion)
+
+	return req, nil
+}
+
+// warmUp sends the warm-up requests concurrently, so each one needs its own
+// connection. Failures only cost the latency they were meant to save and are
+// logged.
+func (s *Checker) warmUp(ctx context.Context, token *oauth2.Token) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.warmConnections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, err := s.catalogRequest(ctx, token)
+			if err != nil {
+				return
+			}
+
+			res, err := s.httpDoer.Do(req)
+			if err != nil {
+				log.Println("Failed to warm up broker connection: " + redact.Error(err, req.Header).Error())
+				return
+			}
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
@@ -1,11 +1,13 @@
 package startupchecker_test
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/gcp-broker-proxy/startupchecker"
 	"code.cloudfoundry.org/gcp-broker-proxy/startupchecker/startupcheckerfakes"
@@ -73,6 +75,78 @@ var _ = Describe("StartupChecks", func() {
 			Expect(version).To(Equal("2.14"))
 		})
 
+		Context("when the broker does not answer", func() {
+			var hang = func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+
+			It("gives up after its own timeout", func() {
+				httpClientFake.DoStub = hang
+				checker = startupchecker.NewChecker(brokerURL, tokenRetrieverFake, httpClientFake, startupchecker.WithTimeout(50*time.Millisecond))
+
+				start := time.Now()
+				err := checker.Perform()
+
+				Expect(errors.Is(err, startupchecker.ErrBrokerUnreachable)).To(BeTrue())
+				Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			})
+
+			It("defaults to DefaultTimeout", func() {
+				var deadline time.Time
+				httpClientFake.DoStub = func(req *http.Request) (*http.Response, error) {
+					deadline, _ = req.Context().Deadline()
+					return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+				}
+
+				Expect(checker.Perform()).To(Succeed())
+				Expect(deadline).To(BeTemporally("~", time.Now().Add(startupchecker.DefaultTimeout), time.Second))
+			})
+		})
+
+		Context("when connection warming is configured", func() {
+			JustBeforeEach(func() {
+				httpClientFake.DoStub = func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+				}
+				checker = startupchecker.NewChecker(brokerURL, tokenRetrieverFake, httpClientFake, startupchecker.WithWarmConnections(3))
+				startupErr = checker.Perform()
+			})
+
+			It("makes the configured number of warm-up calls after the check", func() {
+				Expect(startupErr).NotTo(HaveOccurred())
+				// one call from the outer JustBeforeEach, one check and three warm-up calls
+				Expect(httpClientFake.DoCallCount()).To(Equal(5))
+				for i := 1; i < 5; i++ {
+					req := httpClientFake.DoArgsForCall(i)
+					Expect(req.URL.Path).To(Equal("/v2/catalog"))
+					Expect(req.Header.Get("Authorization")).To(Equal("Bearer my-gcp-token"))
+				}
+			})
+		})
+
+		Context("when an API version is configured", func() {
+			It("calls the catalog with that version", func() {
+				checker = startupchecker.NewChecker(brokerURL, tokenRetrieverFake, httpClientFake, startupchecker.WithAPIVersion("2.16"))
+
+				Expect(checker.Perform()).To(Succeed())
+				req := httpClientFake.DoArgsForCall(1)
+				Expect(req.Header.Get("x-broker-api-version")).To(Equal("2.16"))
+			})
+		})
+
+		Context("when no token retriever is given", func() {
+			It("skips the token step and calls the catalog without an Authorization header", func() {
+				checker = startupchecker.NewChecker(brokerURL, nil, httpClientFake)
+
+				Expect(checker.Perform()).To(Succeed())
+				req := httpClientFake.DoArgsForCall(1)
+				Expect(req.URL.Path).To(Equal("/v2/catalog"))
+				Expect(req.Header).NotTo(HaveKey("Authorization"))
+			})
+		})
+
 		Context("when the token cannot be obtained", func() {
 			BeforeEach(func() {
 				token = nil
@@ -83,6 +157,11 @@ var _ = Describe("StartupChecks", func() {
 				Expect(startupErr).To(HaveOccurred())
 				Expect(startupErr).To(MatchError(ContainSubstring("oops")))
 			})
+
+			It("returns an error matching ErrTokenRetrieval", func() {
+				Expect(errors.Is(startupErr, startupchecker.ErrTokenRetrieval)).To(BeTrue())
+				Expect(errors.Is(startupErr, startupchecker.ErrBrokerUnreachable)).To(BeFalse())
+			})
 		})
 
 		Context("when the broker does not respond", func() {
@@ -94,6 +173,33 @@ var _ = Describe("StartupChecks", func() {
 				Expect(startupErr).To(HaveOccurred())
 				Expect(startupErr).To(MatchError(ContainSubstring("http err")))
 			})
+
+			It("returns an error matching ErrBrokerUnreachable", func() {
+				Expect(errors.Is(startupErr, startupchecker.ErrBrokerUnreachable)).To(BeTrue())
+			})
+		})
+
+		Context("when the broker echoes the bearer token in its error", func() {
+			BeforeEach(func() {
+				brokerStatus = 401
+				brokerBody = "invalid token: my-gcp-token"
+			})
+
+			It("does not include the token in the error", func() {
+				Expect(startupErr).To(MatchError(ContainSubstring("invalid token: [REDACTED]")))
+				Expect(startupErr.Error()).NotTo(ContainSubstring("my-gcp-token"))
+			})
+		})
+
+		Context("when the request error includes the bearer token", func() {
+			BeforeEach(func() {
+				httpClientFake.DoReturnsOnCall(0, nil, errors.New("Authorization: Bearer my-gcp-token rejected"))
+			})
+
+			It("does not include the token in the error", func() {
+				Expect(startupErr).To(MatchError(ContainSubstring("Bearer [REDACTED] rejected")))
+				Expect(startupErr.Error()).NotTo(ContainSubstring("my-gcp-token"))
+			})
 		})
 
 		Context("when the broker responds with a non-200 status code", func() {
@@ -107,6 +213,13 @@ var _ = Describe("StartupChecks", func() {
 				Expect(startupErr).To(MatchError(ContainSubstring("404")))
 				Expect(startupErr).To(MatchError(ContainSubstring("some-broker-msg")))
 			})
+
+			It("returns a BrokerStatusError with the status code", func() {
+				var statusErr *startupchecker.BrokerStatusError
+				Expect(errors.As(startupErr, &statusErr)).To(BeTrue())
+				Expect(statusErr.StatusCode).To(Equal(404))
+				Expect(statusErr.Body).To(Equal("some-broker-msg"))
+			})
 		})
 	})
 })
@@ -0,0 +1,51 @@
+package startupchecker
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type Result struct {
+	BrokerURL *url.URL
+	Err       error
+}
+
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// PerformAll runs the checks of every checker with at most concurrency checks
+// in flight, each bounded by timeout. It waits for all of them and returns one
+// Result per checker, in the same order as the given checkers.
+func PerformAll(checkers []Checker, concurrency int, timeout time.Duration) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Result, len(checkers))
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := range checkers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			results[i] = Result{
+				BrokerURL: checkers[i].brokerURL,
+				Err:       checkers[i].PerformWithContext(ctx),
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
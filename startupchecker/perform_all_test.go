@@ -0,0 +1,116 @@
+package startupchecker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/startupchecker"
+	"code.cloudfoundry.org/gcp-broker-proxy/startupchecker/startupcheckerfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("PerformAll", func() {
+	var newChecker = func(brokerURL string, do func(req *http.Request) (*http.Response, error)) startupchecker.Checker {
+		u, err := url.ParseRequestURI(brokerURL)
+		Expect(err).ToNot(HaveOccurred())
+
+		tokenRetrieverFake := new(startupcheckerfakes.FakeTokenRetriever)
+		tokenRetrieverFake.GetTokenReturns(&oauth2.Token{AccessToken: "my-gcp-token"}, nil)
+
+		httpClientFake := new(startupcheckerfakes.FakeHTTPDoer)
+		httpClientFake.DoStub = do
+
+		return startupchecker.NewChecker(u, tokenRetrieverFake, httpClientFake)
+	}
+
+	var respondWith = func(status int) func(req *http.Request) (*http.Response, error) {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader("broker-msg"))}, nil
+		}
+	}
+
+	It("reports a result per broker in the given order", func() {
+		checkers := []startupchecker.Checker{
+			newChecker("http://broker-a.com", respondWith(http.StatusOK)),
+			newChecker("http://broker-b.com", respondWith(http.StatusInternalServerError)),
+			newChecker("http://broker-c.com", func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("http err")
+			}),
+			newChecker("http://broker-d.com", respondWith(http.StatusOK)),
+		}
+
+		results := startupchecker.PerformAll(checkers, 2, time.Second)
+
+		Expect(results).To(HaveLen(4))
+		Expect(results[0].BrokerURL.Host).To(Equal("broker-a.com"))
+		Expect(results[0].OK()).To(BeTrue())
+
+		Expect(results[1].BrokerURL.Host).To(Equal("broker-b.com"))
+		Expect(results[1].OK()).To(BeFalse())
+		Expect(results[1].Err).To(MatchError(ContainSubstring("500")))
+
+		Expect(results[2].BrokerURL.Host).To(Equal("broker-c.com"))
+		Expect(results[2].OK()).To(BeFalse())
+		Expect(results[2].Err).To(MatchError(ContainSubstring("http err")))
+
+		Expect(results[3].BrokerURL.Host).To(Equal("broker-d.com"))
+		Expect(results[3].OK()).To(BeTrue())
+	})
+
+	It("never runs more checks at once than the given concurrency", func() {
+		var (
+			mu                  sync.Mutex
+			inFlight, maxFlight int
+		)
+
+		slowOK := func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxFlight {
+				maxFlight = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return respondWith(http.StatusOK)(req)
+		}
+
+		var checkers []startupchecker.Checker
+		for i := 0; i < 6; i++ {
+			checkers = append(checkers, newChecker("http://broker.com", slowOK))
+		}
+
+		results := startupchecker.PerformAll(checkers, 2, time.Second)
+
+		Expect(results).To(HaveLen(6))
+		Expect(maxFlight).To(Equal(2))
+	})
+
+	It("fails checks that exceed the timeout without holding up the others", func() {
+		checkers := []startupchecker.Checker{
+			newChecker("http://hanging-broker.com", func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}),
+			newChecker("http://broker.com", respondWith(http.StatusOK)),
+		}
+
+		results := startupchecker.PerformAll(checkers, 2, 50*time.Millisecond)
+
+		Expect(results[0].OK()).To(BeFalse())
+		Expect(results[0].Err).To(MatchError(ContainSubstring("deadline exceeded")))
+		Expect(results[1].OK()).To(BeTrue())
+	})
+})
@@ -0,0 +1,47 @@
+package token
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ClientAuthorization decides what happens to Authorization headers sent by
+// the client besides the basic auth credentials of the proxy itself.
+type ClientAuthorization int
+
+const (
+	// ReplaceClientAuthorization drops them in favour of the injected token.
+	ReplaceClientAuthorization ClientAuthorization = iota
+	// RejectClientAuthorization responds with 400 Bad Request.
+	RejectClientAuthorization
+	// PreserveClientAuthorization forwards the client credentials instead of
+	// injecting a token, for setups passing authentication through.
+	PreserveClientAuthorization
+)
+
+type Option func(*handlerConfig)
+
+type handlerConfig struct {
+	clientAuthorization ClientAuthorization
+}
+
+// WithClientAuthorization sets the policy for Authorization headers from the
+// client. By default the injected token replaces them.
+func WithClientAuthorization(policy ClientAuthorization) Option {
+	return func(c *handlerConfig) {
+		c.clientAuthorization = policy
+	}
+}
+
+// clientCredentials returns the Authorization values of r that are not the
+// basic auth credentials of the proxy, and whether the header was sent more
+// than once.
+func clientCredentials(r *http.Request) (credentials []string, duplicate bool) {
+	values := r.Header.Values("Authorization")
+	for _, value := range values {
+		if !strings.HasPrefix(strings.ToLower(value), "basic ") {
+			credentials = append(credentials, value)
+		}
+	}
+	return credentials, len(values) > 1
+}
@@ -0,0 +1,28 @@
+package token
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/osb"
+)
+
+// TenantSelector selects the retriever of the tenant making the request. The
+// tenant is the user of the originating identity, or else the basic auth
+// username. Unknown tenants get fallback, or are rejected if it is nil.
+func TenantSelector(tenants map[string]TokenRetriever, fallback TokenRetriever) Selector {
+	return func(r *http.Request) (TokenRetriever, bool) {
+		if identity, ok := osb.ParseOriginatingIdentity(r); ok {
+			if tr, ok := tenants[identity.User()]; ok {
+				return tr, true
+			}
+		}
+
+		if username, _, ok := r.BasicAuth(); ok {
+			if tr, ok := tenants[username]; ok {
+				return tr, true
+			}
+		}
+
+		return fallback, fallback != nil
+	}
+}
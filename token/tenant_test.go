@@ -0,0 +1,87 @@
+package token_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+
+	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/token"
+	"code.cloudfoundry.org/gcp-broker-proxy/token/tokenfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TenantSelector", func() {
+	var (
+		req                  *http.Request
+		writer               *httptest.ResponseRecorder
+		orgA, orgB, fallback *tokenfakes.FakeTokenRetriever
+		tenants              map[string]token.TokenRetriever
+		nextCalled           bool
+		next                 http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		req, _ = http.NewRequest("PUT", "/v2/service_instances/123", nil)
+		writer = httptest.NewRecorder()
+
+		orgA = new(tokenfakes.FakeTokenRetriever)
+		orgA.GetTokenReturns(&oauth2.Token{AccessToken: "org-a-token"}, nil)
+		orgB = new(tokenfakes.FakeTokenRetriever)
+		orgB.GetTokenReturns(&oauth2.Token{AccessToken: "org-b-token"}, nil)
+		fallback = new(tokenfakes.FakeTokenRetriever)
+		fallback.GetTokenReturns(&oauth2.Token{AccessToken: "default-token"}, nil)
+
+		tenants = map[string]token.TokenRetriever{"user-a": orgA, "platform-b": orgB}
+
+		nextCalled = false
+		next = func(w http.ResponseWriter, r *http.Request) { nextCalled = true }
+	})
+
+	var setIdentity = func(userID string) {
+		value := base64.StdEncoding.EncodeToString([]byte(`{"user_id": "` + userID + `"}`))
+		req.Header.Set("X-Broker-API-Originating-Identity", "cloudfoundry "+value)
+	}
+
+	It("uses the retriever of the originating identity's user", func() {
+		setIdentity("user-a")
+		token.SelectingTokenHandler(token.TenantSelector(tenants, fallback))(writer, req, next)
+
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer org-a-token"))
+		Expect(fallback.GetTokenCallCount()).To(Equal(0))
+	})
+
+	It("uses the retriever of the basic auth username", func() {
+		req.SetBasicAuth("platform-b", "password")
+		token.SelectingTokenHandler(token.TenantSelector(tenants, fallback))(writer, req, next)
+
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer org-b-token"))
+	})
+
+	Context("for an unknown tenant", func() {
+		BeforeEach(func() {
+			setIdentity("someone-else")
+		})
+
+		It("uses the fallback retriever", func() {
+			token.SelectingTokenHandler(token.TenantSelector(tenants, fallback))(writer, req, next)
+
+			Expect(req.Header.Get("Authorization")).To(Equal("Bearer default-token"))
+			Expect(nextCalled).To(BeTrue())
+		})
+
+		Context("when there is no fallback", func() {
+			It("responds with 403 without calling the next handler", func() {
+				token.SelectingTokenHandler(token.TenantSelector(tenants, nil))(writer, req, next)
+
+				Expect(writer.Code).To(Equal(http.StatusForbidden))
+				Expect(writer.Body.String()).To(Equal("No service account configured for this tenant"))
+				Expect(req.Header.Get("Authorization")).To(BeEmpty())
+				Expect(nextCalled).To(BeFalse())
+			})
+		})
+	})
+})
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/urfave/negroni"
 
 	"golang.org/x/oauth2"
+
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
 )
 
 //go:generate counterfeiter . TokenRetriever
@@ -15,20 +18,85 @@ type TokenRetriever interface {
 	GetToken() (*oauth2.Token, error)
 }
 
-func TokenHandler(tr TokenRetriever) negroni.HandlerFunc {
+// Selector picks the TokenRetriever for a request. It returns false when no
+// retriever may be used for the request.
+type Selector func(r *http.Request) (TokenRetriever, bool)
+
+// TokenHandler sets a bearer token from tr on every request. A nil tr, for
+// brokers that need no token, injects nothing; Authorization headers from the
+// client are still handled as the options say.
+func TokenHandler(tr TokenRetriever, opts ...Option) negroni.HandlerFunc {
+	return SelectingTokenHandler(func(r *http.Request) (TokenRetriever, bool) {
+		return tr, true
+	}, opts...)
+}
+
+func SelectingTokenHandler(selector Selector, opts ...Option) negroni.HandlerFunc {
+	var lastBearer atomic.Value
+
+	cfg := &handlerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if credentials, duplicate := clientCredentials(r); len(credentials) > 0 || duplicate {
+			switch cfg.clientAuthorization {
+			case RejectClientAuthorization:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Requests must not carry their own Authorization header"))
+				return
+			case PreserveClientAuthorization:
+				if len(credentials) > 0 {
+					r.Header["Authorization"] = credentials
+					next(w, r)
+					return
+				}
+			}
+		}
+
+		tr, ok := selector(r)
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("No service account configured for this tenant"))
+			return
+		}
+
+		if tr == nil {
+			r.Header.Del("Authorization")
+			next(w, r)
+			return
+		}
+
 		token, err := tr.GetToken()
 		if err != nil {
 			w.WriteHeader(http.StatusBadGateway)
 
-			msg := fmt.Sprintf("Error retrieving OAuth token: %s", err.Error())
+			msg := fmt.Sprintf("Error retrieving OAuth token: %s", redact.Error(err, r.Header))
 			log.Println(msg)
 			w.Write([]byte(msg))
 			return
 		}
 
-		r.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		r.Header.Set("Authorization", bearerValue(&lastBearer, token.AccessToken))
 
 		next(w, r)
 	})
 }
+
+type bearer struct {
+	accessToken string
+	value       string
+}
+
+// bearerValue returns the Authorization value for accessToken, reusing the
+// last one built while the token does not change.
+func bearerValue(last *atomic.Value, accessToken string) string {
+	if cached, ok := last.Load().(bearer); ok && cached.accessToken == accessToken {
+		return cached.value
+	}
+
+	value := "Bearer " + accessToken
+	last.Store(bearer{accessToken: accessToken, value: value})
+	return value
+}
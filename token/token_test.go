@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/oauth2"
 
+	"code.cloudfoundry.org/gcp-broker-proxy/redact"
 	"code.cloudfoundry.org/gcp-broker-proxy/token"
 	"code.cloudfoundry.org/gcp-broker-proxy/token/tokenfakes"
 
@@ -47,6 +48,87 @@ var _ = Describe("TokenHandler", func() {
 			tokenHandler(writer, req, noOpHandler)
 			Expect(req.Header.Get("Authorization")).Should(Equal("Bearer 123"))
 		})
+
+		Describe("Authorization headers from the client", func() {
+			var clientReq *http.Request
+
+			BeforeEach(func() {
+				clientReq, _ = http.NewRequest("GET", "/v2/catalog", nil)
+				clientReq.SetBasicAuth("user", "pass")
+				clientReq.Header.Add("Authorization", "Bearer client-token")
+			})
+
+			It("replaces them with the token by default", func() {
+				token.TokenHandler(tokenRetrieverFake)(httptest.NewRecorder(), clientReq, noOpHandler)
+
+				Expect(clientReq.Header.Values("Authorization")).To(Equal([]string{"Bearer 123"}))
+			})
+
+			It("rejects the request when configured to", func() {
+				writer := httptest.NewRecorder()
+				nextCalled := false
+				token.TokenHandler(tokenRetrieverFake, token.WithClientAuthorization(token.RejectClientAuthorization))(writer, clientReq, func(http.ResponseWriter, *http.Request) {
+					nextCalled = true
+				})
+
+				Expect(writer.Code).To(Equal(http.StatusBadRequest))
+				Expect(nextCalled).To(BeFalse())
+				Expect(tokenRetrieverFake.GetTokenCallCount()).To(BeZero())
+			})
+
+			It("forwards the client credentials when configured to preserve them", func() {
+				token.TokenHandler(tokenRetrieverFake, token.WithClientAuthorization(token.PreserveClientAuthorization))(httptest.NewRecorder(), clientReq, noOpHandler)
+
+				Expect(clientReq.Header.Values("Authorization")).To(Equal([]string{"Bearer client-token"}))
+				Expect(tokenRetrieverFake.GetTokenCallCount()).To(BeZero())
+			})
+
+			It("injects the token for requests with only the proxy credentials in every mode", func() {
+				for _, policy := range []token.ClientAuthorization{token.ReplaceClientAuthorization, token.RejectClientAuthorization, token.PreserveClientAuthorization} {
+					basicReq, _ := http.NewRequest("GET", "/v2/catalog", nil)
+					basicReq.SetBasicAuth("user", "pass")
+
+					token.TokenHandler(tokenRetrieverFake, token.WithClientAuthorization(policy))(httptest.NewRecorder(), basicReq, noOpHandler)
+
+					Expect(basicReq.Header.Values("Authorization")).To(Equal([]string{"Bearer 123"}))
+				}
+			})
+		})
+
+		It("uses the new token once the token changes", func() {
+			tokenHandler := token.TokenHandler(tokenRetrieverFake)
+
+			tokenHandler(httptest.NewRecorder(), req, noOpHandler)
+			Expect(req.Header.Get("Authorization")).Should(Equal("Bearer 123"))
+
+			tokenRetrieverFake.GetTokenReturns(&oauth2.Token{AccessToken: "456"}, nil)
+			tokenHandler(httptest.NewRecorder(), req, noOpHandler)
+			Expect(req.Header.Get("Authorization")).Should(Equal("Bearer 456"))
+		})
+	})
+
+	Context("when no token retriever is given", func() {
+		It("forwards the request without an Authorization header", func() {
+			clientReq, _ := http.NewRequest("GET", "/v2/catalog", nil)
+			clientReq.SetBasicAuth("user", "pass")
+			nextCalled := false
+
+			token.TokenHandler(nil)(httptest.NewRecorder(), clientReq, func(http.ResponseWriter, *http.Request) {
+				nextCalled = true
+			})
+
+			Expect(nextCalled).To(BeTrue())
+			Expect(clientReq.Header).NotTo(HaveKey("Authorization"))
+		})
+
+		It("still applies the client authorization policy", func() {
+			clientReq, _ := http.NewRequest("GET", "/v2/catalog", nil)
+			clientReq.Header.Set("Authorization", "Bearer client-token")
+
+			token.TokenHandler(nil, token.WithClientAuthorization(token.PreserveClientAuthorization))(httptest.NewRecorder(), clientReq, noOpHandler)
+
+			Expect(clientReq.Header.Get("Authorization")).To(Equal("Bearer client-token"))
+		})
 	})
 
 	Context("when getting the token fails", func() {
@@ -91,5 +173,16 @@ var _ = Describe("TokenHandler", func() {
 			tokenHandler(writer, req, noOpHandler)
 			Expect(buf.String()).To(ContainSubstring("Error retrieving OAuth token: oops"))
 		})
+
+		It("redacts secrets from the error", func() {
+			redact.SetQueryParams("client_secret")
+			defer redact.SetQueryParams()
+			tokenRetrieverFake.GetTokenReturns(nil, errors.New("oops: https://oauth2.example.com/token?client_secret=hunter2"))
+
+			tokenHandler(writer, req, noOpHandler)
+
+			Expect(writer.Body.String()).To(Equal("Error retrieving OAuth token: oops: https://oauth2.example.com/token?client_secret=[REDACTED]"))
+			Expect(buf.String()).NotTo(ContainSubstring("hunter2"))
+		})
 	})
 })